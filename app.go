@@ -1,28 +1,78 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/Financial-Times/go-fthealth/v1a"
 	"github.com/Financial-Times/service-status-go/httphandlers"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
 	"github.com/jawher/mow.cli"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const resSeparator = ","
 
 type httpHandler struct {
-	s service
+	s              service
+	checkResources bool
+	cache          *healthcheckCache
+	health         healthSettings
 }
 
 func main() {
 	app := cli.App("Factset reader", "Reads data from factset ftp server and stores it to amazon s3")
 
+	storageBackend := app.String(cli.StringOpt{
+		Name:   "storage-backend",
+		Value:  s3Backend,
+		Desc:   "storage backend the files are published to: s3, gcs (HMAC keys as access/secret key), azure, fs (bucket-name is a local directory) or sftp (bucket-name is a remote directory)",
+		EnvVar: "STORAGE_BACKEND",
+	})
+	azureAccount := app.String(cli.StringOpt{
+		Name:   "azure-account",
+		Value:  "",
+		Desc:   "storage account of the azure backend, bucket-name is the container",
+		EnvVar: "AZURE_STORAGE_ACCOUNT",
+	})
+	azureSASToken := app.String(cli.StringOpt{
+		Name:   "azure-sas-token",
+		Value:  "",
+		Desc:   "SAS token of the azure container",
+		EnvVar: "AZURE_SAS_TOKEN",
+	})
+	sftpPushAddress := app.String(cli.StringOpt{
+		Name:   "sftp-push-address",
+		Value:  "",
+		Desc:   "address of the sftp server of the sftp backend",
+		EnvVar: "SFTP_PUSH_ADDRESS",
+	})
+	sftpPushPort := app.Int(cli.IntOpt{
+		Name:   "sftp-push-port",
+		Value:  22,
+		Desc:   "port of the sftp server of the sftp backend",
+		EnvVar: "SFTP_PUSH_PORT",
+	})
+	sftpPushUser := app.String(cli.StringOpt{
+		Name:   "sftp-push-username",
+		Value:  "",
+		Desc:   "username of the sftp backend",
+		EnvVar: "SFTP_PUSH_USERNAME",
+	})
+	sftpPushKey := app.String(cli.StringOpt{
+		Name:   "sftp-push-key",
+		Value:  "",
+		Desc:   "ssh key of the sftp backend",
+		EnvVar: "SFTP_PUSH_KEY",
+	})
 	awsAccessKey := app.String(cli.StringOpt{
 		Name:   "aws-access-key-id",
 		Desc:   "s3 access key",
@@ -33,6 +83,42 @@ func main() {
 		Desc:   "s3 secret key",
 		EnvVar: "AWS_SECRET_ACCESS_KEY",
 	})
+	s3Credentials := app.String(cli.StringOpt{
+		Name:   "s3-credentials",
+		Value:  staticCredentials,
+		Desc:   "source of the s3 credentials: static (access key and secret key), env, profile, iam (EC2/ECS instance role or EKS web identity) or chain (env, profile, then iam)",
+		EnvVar: "S3_CREDENTIALS",
+	})
+	awsProfile := app.String(cli.StringOpt{
+		Name:   "aws-profile",
+		Value:  "",
+		Desc:   "profile of the shared credentials file used by the profile and chain s3 credentials",
+		EnvVar: "AWS_PROFILE",
+	})
+	s3RoleARN := app.String(cli.StringOpt{
+		Name:   "s3-assume-role-arn",
+		Value:  "",
+		Desc:   "ARN of a role to assume via STS with the s3 credentials",
+		EnvVar: "S3_ASSUME_ROLE_ARN",
+	})
+	s3RoleSessionName := app.String(cli.StringOpt{
+		Name:   "s3-assume-role-session-name",
+		Value:  defaultRoleSessionName,
+		Desc:   "session name used when assuming the s3 role",
+		EnvVar: "S3_ASSUME_ROLE_SESSION_NAME",
+	})
+	stsEndpoint := app.String(cli.StringOpt{
+		Name:   "sts-endpoint",
+		Value:  defaultSTSEndpoint,
+		Desc:   "STS endpoint used to assume the s3 role",
+		EnvVar: "STS_ENDPOINT",
+	})
+	s3Region := app.String(cli.StringOpt{
+		Name:   "s3-region",
+		Value:  "",
+		Desc:   "region of the factset bucket, looked up if not set",
+		EnvVar: "S3_REGION",
+	})
 	bucketName := app.String(cli.StringOpt{
 		Name:   "bucket-name",
 		Desc:   "bucket name of factset data",
@@ -44,6 +130,281 @@ func main() {
 		Desc:   "s3 domain of factset bucket",
 		EnvVar: "S3_DOMAIN",
 	})
+	s3KeyTemplate := app.String(cli.StringOpt{
+		Name:   "s3-key-template",
+		Value:  defaultKeyTemplate,
+		Desc:   "template of the s3 keys of the uploaded files, placeholders: {env}, {kind}, {yyyy}, {mm}, {dd}, {jobId}, {file}",
+		EnvVar: "S3_KEY_TEMPLATE",
+	})
+	s3PointerTemplate := app.String(cli.StringOpt{
+		Name:   "s3-pointer-template",
+		Value:  defaultPointerTemplate,
+		Desc:   "template of the s3 keys of the daily/weekly pointers, placeholders: {env}, {kind}",
+		EnvVar: "S3_POINTER_TEMPLATE",
+	})
+	s3SSE := app.String(cli.StringOpt{
+		Name:   "s3-sse",
+		Value:  sseNone,
+		Desc:   "server side encryption of the uploaded files: none, sse-s3 or sse-kms",
+		EnvVar: "S3_SSE",
+	})
+	s3KMSKeyID := app.String(cli.StringOpt{
+		Name:   "s3-sse-kms-key-id",
+		Desc:   "KMS key ID used with sse-kms server side encryption",
+		EnvVar: "S3_SSE_KMS_KEY_ID",
+	})
+	s3StorageClasses := app.String(cli.StringOpt{
+		Name:   "s3-storage-classes",
+		Value:  "",
+		Desc:   "storage class per object kind (daily, weekly, manifest, pointer), e.g. daily:STANDARD_IA,manifest:STANDARD",
+		EnvVar: "S3_STORAGE_CLASSES",
+	})
+	s3ObjectTags := app.String(cli.StringOpt{
+		Name:   "s3-object-tags",
+		Value:  "",
+		Desc:   "tags of all uploaded objects, e.g. team=content,data=factset",
+		EnvVar: "S3_OBJECT_TAGS",
+	})
+	env := app.String(cli.StringOpt{
+		Name:   "environment",
+		Value:  "",
+		Desc:   "environment name used in the {env} placeholder of the s3 key templates",
+		EnvVar: "ENVIRONMENT",
+	})
+	destinations := app.String(cli.StringOpt{
+		Name:   "destinations",
+		Value:  "",
+		Desc:   "JSON array of additional destinations the files are published to, e.g. [{\"name\":\"dr\",\"bucket\":\"factset-dr\",\"region\":\"eu-central-1\"}]; fields not set are taken from the primary destination",
+		EnvVar: "DESTINATIONS",
+	})
+	destinationsPolicy := app.String(cli.StringOpt{
+		Name:   "destinations-policy",
+		Value:  allDestinations,
+		Desc:   "when an import counts as successful: all (every destination published), any (at least one) or primary (at least the primary one)",
+		EnvVar: "DESTINATIONS_POLICY",
+	})
+	uploadAttempts := app.Int(cli.IntOpt{
+		Name:   "upload-attempts",
+		Value:  3,
+		Desc:   "number of times an upload is tried until its size and checksum match the local file",
+		EnvVar: "UPLOAD_ATTEMPTS",
+	})
+	s3PartSize := app.Int(cli.IntOpt{
+		Name:   "s3-part-size",
+		Value:  0,
+		Desc:   "part size in MiB of multipart uploads to s3, at least 5; 0 lets the client choose by file size",
+		EnvVar: "S3_PART_SIZE",
+	})
+	s3UploadThreads := app.Int(cli.IntOpt{
+		Name:   "s3-upload-threads",
+		Value:  4,
+		Desc:   "number of parts of a multipart upload uploaded in parallel",
+		EnvVar: "S3_UPLOAD_THREADS",
+	})
+	s3MaxRetries := app.Int(cli.IntOpt{
+		Name:   "s3-max-retries",
+		Value:  10,
+		Desc:   "number of times every s3 request, including every part of a multipart upload, is retried",
+		EnvVar: "S3_MAX_RETRIES",
+	})
+	retentionDailyDays := app.Int(cli.IntOpt{
+		Name:   "retention-daily-days",
+		Value:  0,
+		Desc:   "number of days daily files are kept for, 0 keeps them forever",
+		EnvVar: "RETENTION_DAILY_DAYS",
+	})
+	retentionWeeklyCount := app.Int(cli.IntOpt{
+		Name:   "retention-weekly-count",
+		Value:  0,
+		Desc:   "number of weekly files kept, 0 keeps them all",
+		EnvVar: "RETENTION_WEEKLY_COUNT",
+	})
+	retentionDryRun := app.Bool(cli.BoolOpt{
+		Name:   "retention-dry-run",
+		Value:  false,
+		Desc:   "only log what the retention policy would delete after an import",
+		EnvVar: "RETENTION_DRY_RUN",
+	})
+	dryRun := app.Bool(cli.BoolOpt{
+		Name:   "dry-run",
+		Value:  false,
+		Desc:   "only report which Factset packages the imports would take and where they would be uploaded, without writing anything",
+		EnvVar: "DRY_RUN",
+	})
+	remoteRoots := app.String(cli.StringOpt{
+		Name:   "remote-roots",
+		Value:  "",
+		Desc:   "comma separated directories of the factset server that can be listed with the remote endpoint, by default the directories of the factset resources",
+		EnvVar: "REMOTE_ROOTS",
+	})
+	logLevel := app.String(cli.StringOpt{
+		Name:   "log-level",
+		Value:  "info",
+		Desc:   "log level: debug, info, warning, error, fatal or panic",
+		EnvVar: "LOG_LEVEL",
+	})
+	logFormat := app.String(cli.StringOpt{
+		Name:   "log-format",
+		Value:  jsonLogFormat,
+		Desc:   "log format: json, with the job ID, resource, archive, phase, bytes and duration as fields, or text",
+		EnvVar: "LOG_FORMAT",
+	})
+	dailyMaxAge := app.Int(cli.IntOpt{
+		Name:   "daily-max-age",
+		Value:  0,
+		Desc:   "hours after the last successful daily import after which the freshness healthcheck fails, 0 disables the check",
+		EnvVar: "DAILY_MAX_AGE",
+	})
+	weeklyMaxAge := app.Int(cli.IntOpt{
+		Name:   "weekly-max-age",
+		Value:  0,
+		Desc:   "hours after the last successful weekly import after which the freshness healthcheck fails, 0 disables the check",
+		EnvVar: "WEEKLY_MAX_AGE",
+	})
+	checkResources := app.Bool(cli.BoolOpt{
+		Name:   "check-resources",
+		Value:  false,
+		Desc:   "add a healthcheck that the directory of every factset resource can be listed and holds a package of the resource",
+		EnvVar: "CHECK_RESOURCES",
+	})
+	healthcheckInterval := app.Int(cli.IntOpt{
+		Name:   "healthcheck-interval",
+		Value:  60,
+		Desc:   "seconds between the background runs of the healthchecks, whose results the health and gtg endpoints report; 0 runs the checks on every request",
+		EnvVar: "HEALTHCHECK_INTERVAL",
+	})
+	healthcheckMaxStaleness := app.Int(cli.IntOpt{
+		Name:   "healthcheck-max-staleness",
+		Value:  180,
+		Desc:   "seconds after which the last result of a healthcheck counts as failed",
+		EnvVar: "HEALTHCHECK_MAX_STALENESS",
+	})
+	systemCode := app.String(cli.StringOpt{
+		Name:   "system-code",
+		Value:  "factset-reader",
+		Desc:   "system code reported by the health endpoint",
+		EnvVar: "SYSTEM_CODE",
+	})
+	healthcheckRunbook := app.String(cli.StringOpt{
+		Name:   "healthcheck-runbook",
+		Value:  "https://github.com/Financial-Times/factset-reader",
+		Desc:   "runbook (panic guide) link of the healthchecks",
+		EnvVar: "HEALTHCHECK_RUNBOOK",
+	})
+	healthcheckRunbooks := app.String(cli.StringOpt{
+		Name:   "healthcheck-runbooks",
+		Value:  "",
+		Desc:   "comma separated runbook links of single healthchecks, replacing healthcheck-runbook, e.g. index-files=https://runbooks.example.com/factset#index-files",
+		EnvVar: "HEALTHCHECK_RUNBOOKS",
+	})
+	healthcheckSeverities := app.String(cli.StringOpt{
+		Name:   "healthcheck-severities",
+		Value:  "",
+		Desc:   "comma separated severities (1 to 3) of single healthchecks, e.g. daily-import-freshness=2,factset-connectivity=1",
+		EnvVar: "HEALTHCHECK_SEVERITIES",
+	})
+	notifyWebhookURL := app.String(cli.StringOpt{
+		Name:   "notify-webhook-url",
+		Value:  "",
+		Desc:   "url the finished import jobs are posted to as JSON",
+		EnvVar: "NOTIFY_WEBHOOK_URL",
+	})
+	notifySlackURL := app.String(cli.StringOpt{
+		Name:   "notify-slack-url",
+		Value:  "",
+		Desc:   "Slack incoming webhook url the finished import jobs are posted to",
+		EnvVar: "NOTIFY_SLACK_URL",
+	})
+	notifySMTPAddress := app.String(cli.StringOpt{
+		Name:   "notify-smtp-address",
+		Value:  "",
+		Desc:   "host:port of the smtp server sending emails about finished import jobs",
+		EnvVar: "NOTIFY_SMTP_ADDRESS",
+	})
+	notifySMTPUsername := app.String(cli.StringOpt{
+		Name:   "notify-smtp-username",
+		Value:  "",
+		Desc:   "smtp username, if the server requires authentication",
+		EnvVar: "NOTIFY_SMTP_USERNAME",
+	})
+	notifySMTPPassword := app.String(cli.StringOpt{
+		Name:   "notify-smtp-password",
+		Value:  "",
+		Desc:   "smtp password",
+		EnvVar: "NOTIFY_SMTP_PASSWORD",
+	})
+	notifyEmailFrom := app.String(cli.StringOpt{
+		Name:   "notify-email-from",
+		Value:  "",
+		Desc:   "sender of the notification emails",
+		EnvVar: "NOTIFY_EMAIL_FROM",
+	})
+	notifyEmailTo := app.String(cli.StringOpt{
+		Name:   "notify-email-to",
+		Value:  "",
+		Desc:   "comma separated recipients of the notification emails",
+		EnvVar: "NOTIFY_EMAIL_TO",
+	})
+	notifyOnSuccess := app.Bool(cli.BoolOpt{
+		Name:   "notify-on-success",
+		Value:  false,
+		Desc:   "notify about every successful import job, not only about failures and recoveries",
+		EnvVar: "NOTIFY_ON_SUCCESS",
+	})
+	statusBaseURL := app.String(cli.StringOpt{
+		Name:   "status-base-url",
+		Value:  "http://localhost:8080",
+		Desc:   "url of this service the notifications link the job status to",
+		EnvVar: "STATUS_BASE_URL",
+	})
+	eventsHTTPURL := app.String(cli.StringOpt{
+		Name:   "events-http-url",
+		Value:  "",
+		Desc:   "url an event is posted to as JSON after every successful publish",
+		EnvVar: "EVENTS_HTTP_URL",
+	})
+	eventsKafkaBrokers := app.String(cli.StringOpt{
+		Name:   "events-kafka-brokers",
+		Value:  "",
+		Desc:   "comma separated host:port of the Kafka brokers the publish events are produced to",
+		EnvVar: "EVENTS_KAFKA_BROKERS",
+	})
+	eventsKafkaTopic := app.String(cli.StringOpt{
+		Name:   "events-kafka-topic",
+		Value:  "",
+		Desc:   "Kafka topic of the publish events",
+		EnvVar: "EVENTS_KAFKA_TOPIC",
+	})
+	eventsSNSTopicARN := app.String(cli.StringOpt{
+		Name:   "events-sns-topic-arn",
+		Value:  "",
+		Desc:   "SNS topic the publish events are published to, using the AWS credentials of the primary destination",
+		EnvVar: "EVENTS_SNS_TOPIC_ARN",
+	})
+	eventsSQSQueueURL := app.String(cli.StringOpt{
+		Name:   "events-sqs-queue-url",
+		Value:  "",
+		Desc:   "SQS queue the publish events are sent to, using the AWS credentials of the primary destination",
+		EnvVar: "EVENTS_SQS_QUEUE_URL",
+	})
+	downloadTimeout := app.Int(cli.IntOpt{
+		Name:   "download-timeout",
+		Value:  120,
+		Desc:   "minutes the download of all resources of an import may take, 0 for no limit",
+		EnvVar: "DOWNLOAD_TIMEOUT",
+	})
+	uploadTimeout := app.Int(cli.IntOpt{
+		Name:   "upload-timeout",
+		Value:  120,
+		Desc:   "minutes the upload of an import to all destinations may take, 0 for no limit",
+		EnvVar: "UPLOAD_TIMEOUT",
+	})
+	shutdownGracePeriod := app.Int(cli.IntOpt{
+		Name:   "shutdown-grace-period",
+		Value:  20,
+		Desc:   "seconds a running import job may take to finish on SIGTERM before it is aborted",
+		EnvVar: "SHUTDOWN_GRACE_PERIOD",
+	})
 	port := app.Int(cli.IntOpt{
 		Name:   "port",
 		Value:  8080,
@@ -80,12 +441,106 @@ func main() {
 		EnvVar: "FACTSET_RESOURCES",
 	})
 
-	app.Action = func() {
+	newService := func() service {
+		if err := configureLogging(*logLevel, *logFormat); err != nil {
+			log.Fatal(err)
+		}
+		setS3MaxRetries(*s3MaxRetries)
+		storageClasses, err := getStorageClasses(*s3StorageClasses)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tags, err := getKeyValues(*s3ObjectTags, "=")
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		s3 := s3Config{
-			accKey:    *awsAccessKey,
-			secretKey: *awsSecretKey,
-			bucket:    *bucketName,
-			domain:    *s3Domain,
+			backend:         *storageBackend,
+			accKey:          *awsAccessKey,
+			secretKey:       *awsSecretKey,
+			bucket:          *bucketName,
+			domain:          *s3Domain,
+			keyTemplate:     *s3KeyTemplate,
+			pointerTemplate: *s3PointerTemplate,
+			env:             *env,
+			sse:             *s3SSE,
+			kmsKeyID:        *s3KMSKeyID,
+			storageClasses:  storageClasses,
+			tags:            tags,
+			region:          *s3Region,
+			credentials:     *s3Credentials,
+			profile:         *awsProfile,
+			roleARN:         *s3RoleARN,
+			roleSessionName: *s3RoleSessionName,
+			stsEndpoint:     *stsEndpoint,
+			azureAccount:    *azureAccount,
+			azureSASToken:   *azureSASToken,
+			sftpPush: sftpConfig{
+				address:  *sftpPushAddress,
+				port:     *sftpPushPort,
+				username: *sftpPushUser,
+				key:      *sftpPushKey,
+			},
+			uploadAttempts: *uploadAttempts,
+			partSize:       int64(*s3PartSize) * 1024 * 1024,
+			uploadThreads:  *s3UploadThreads,
+			retention: retentionPolicy{
+				dailyDays:   *retentionDailyDays,
+				weeklyCount: *retentionWeeklyCount,
+				dryRun:      *retentionDryRun,
+			},
+		}
+		s3.events, err = newEventEmitter(eventsConfig{
+			httpURL:      *eventsHTTPURL,
+			kafkaBrokers: *eventsKafkaBrokers,
+			kafkaTopic:   *eventsKafkaTopic,
+			snsTopicARN:  *eventsSNSTopicARN,
+			sqsQueueURL:  *eventsSQSQueueURL,
+			aws:          s3,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		dests, err := getDestinations(s3, *destinations)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := validateDestinationsPolicy(*destinationsPolicy); err != nil {
+			log.Fatal(err)
+		}
+		for _, d := range dests {
+			layout, err := newKeyLayout(d.config.keyTemplate, d.config.pointerTemplate, d.config.env)
+			if err != nil {
+				log.Fatalf("Destination [%s]: %v", d.name, err)
+			}
+			if d.config.retention.dailyDays < 0 || d.config.retention.weeklyCount < 0 {
+				log.Fatalf("Destination [%s]: retention limits must not be negative", d.name)
+			}
+			if err := d.config.retention.validate(layout); err != nil {
+				log.Fatalf("Destination [%s]: %v", d.name, err)
+			}
+			if err := validateStorageConfig(d.config); err != nil {
+				log.Fatalf("Destination [%s]: %v", d.name, err)
+			}
+		}
+		if err := validateResourceLayouts(getResourceList(*resources), dests); err != nil {
+			log.Fatal(err)
+		}
+
+		notifier, err := newJobNotifier(notifyConfig{
+			webhookURL:   *notifyWebhookURL,
+			slackURL:     *notifySlackURL,
+			smtpAddress:  *notifySMTPAddress,
+			smtpUsername: *notifySMTPUsername,
+			smtpPassword: *notifySMTPPassword,
+			emailFrom:    *notifyEmailFrom,
+			emailTo:      *notifyEmailTo,
+			onSuccess:    *notifyOnSuccess,
+			baseURL:      *statusBaseURL,
+		})
+		if err != nil {
+			log.Fatal(err)
 		}
 
 		fc := sftpConfig{
@@ -96,16 +551,96 @@ func main() {
 		}
 
 		s := service{
-			rdConfig: fc,
-			wrConfig: s3,
-			files:    getResourceList(*resources),
+			rdConfig:           fc,
+			wrConfig:           s3,
+			destinations:       dests,
+			destinationsPolicy: *destinationsPolicy,
+			files:              getResourceList(*resources),
+			dryRun:             *dryRun,
+			remoteRoots:        getRemoteRoots(*remoteRoots, getResourceList(*resources)),
+			jobs:               newJobRegistry(defaultJobHistory),
+			history:            newImportHistory(),
+			notifier:           notifier,
+			maxImportAge: map[string]time.Duration{
+				daily:  time.Duration(*dailyMaxAge) * time.Hour,
+				weekly: time.Duration(*weeklyMaxAge) * time.Hour,
+			},
+			phaseTimeouts: map[string]time.Duration{
+				downloadPhase: time.Duration(*downloadTimeout) * time.Minute,
+				uploadPhase:   time.Duration(*uploadTimeout) * time.Minute,
+			},
 		}
 
 		log.Printf("Resource list: %v", s.files)
+		return s
+	}
 
-		httpHandler := &httpHandler{s: s}
-		listen(httpHandler, *port)
+	serve := func() {
+		runbooks, err := getRunbooks(*healthcheckRunbooks)
+		if err != nil {
+			log.Fatal(err)
+		}
+		severities, err := getSeverities(*healthcheckSeverities)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpHandler := &httpHandler{
+			s:              newService(),
+			checkResources: *checkResources,
+			health:         healthSettings{systemCode: *systemCode, runbook: *healthcheckRunbook, runbooks: runbooks, severities: severities},
+		}
+		if *healthcheckInterval > 0 {
+			if *healthcheckMaxStaleness < *healthcheckInterval {
+				log.Fatal("healthcheck-max-staleness must not be shorter than healthcheck-interval")
+			}
+			httpHandler.cacheChecks(newHealthcheckCache(time.Duration(*healthcheckInterval)*time.Second, time.Duration(*healthcheckMaxStaleness)*time.Second))
+		}
+		listen(httpHandler, *port, time.Duration(*shutdownGracePeriod)*time.Second)
 	}
+	app.Action = serve
+
+	app.Command("serve", "start the http server (the default when no command is given)", func(cmd *cli.Cmd) {
+		cmd.Action = serve
+	})
+	app.Command("import", "run an import once and exit, with a non-zero status if it fails", func(cmd *cli.Cmd) {
+		importWeekly := cmd.BoolOpt("weekly", false, "import the weekly (full) packages")
+		importResources := cmd.StringsOpt("resource", []string{}, "resource to import as <archive>:<file names>[:<key template>:<pointer template>], replacing factsetResources (repeatable)")
+		importDryRun := cmd.BoolOpt("dry-run", false, "write what the import would do to stdout instead of uploading")
+		cmd.Action = func() {
+			s := newService()
+			s.weekly = *importWeekly
+			s.dryRun = s.dryRun || *importDryRun
+			if len(*importResources) > 0 {
+				s.files = getResourceList(strings.Join(*importResources, resSeparator))
+				if err := validateResourceLayouts(s.files, s.writeDestinations()); err != nil {
+					exitOnError(err)
+				}
+			}
+			go shutdownOnSignal(s.jobs, time.Duration(*shutdownGracePeriod)*time.Second)
+			exitOnError(s.runImport(os.Stdout))
+		}
+	})
+	app.Command("list-remote", "list a directory on the factset server", func(cmd *cli.Cmd) {
+		dir := cmd.StringArg("DIR", "", "directory on the factset server")
+		cmd.Action = func() {
+			exitOnError(newService().listRemote(*dir, os.Stdout))
+		}
+	})
+	app.Command("resolve", "show the packages an import of a resource would download", func(cmd *cli.Cmd) {
+		resolveWeekly := cmd.BoolOpt("weekly", false, "resolve the weekly (full) packages")
+		resource := cmd.StringArg("RESOURCE", "", "resource as <archive>:<file names>")
+		cmd.Action = func() {
+			exitOnError(newService().resolve(*resource, *resolveWeekly, os.Stdout))
+		}
+	})
+	app.Command("publish", "upload the daily.zip and weekly.zip of a local directory to the destinations", func(cmd *cli.Cmd) {
+		src := cmd.StringArg("LOCAL_DIR", "", "directory containing daily.zip and/or weekly.zip")
+		cmd.Action = func() {
+			s := newService()
+			go shutdownOnSignal(s.jobs, time.Duration(*shutdownGracePeriod)*time.Second)
+			exitOnError(s.publishLocal(*src))
+		}
+	})
 
 	err := app.Run(os.Args)
 	if err != nil {
@@ -113,6 +648,15 @@ func main() {
 	}
 }
 
+// exitOnError ends a one-shot command with a failure status if it returned an error
+func exitOnError(err error) {
+	if err != nil {
+		log.Error(err)
+		cli.Exit(exitFailed)
+	}
+}
+
+// getResourceList parses the resources argument; a resource can end with a key and a pointer template of its own
 func getResourceList(resources string) []factsetResource {
 	if resources == "" {
 		return []factsetResource{}
@@ -121,27 +665,109 @@ func getResourceList(resources string) []factsetResource {
 	resList := strings.Split(resources, resSeparator)
 	for _, fulRes := range resList {
 		resPath := strings.Split(fulRes, ":")
-		if len(resPath) == 2 {
+		if len(resPath) >= 2 && len(resPath) <= 4 {
 			fr := factsetResource{
 				archive:   resPath[0],
 				fileNames: resPath[1],
 			}
+			if len(resPath) > 2 {
+				fr.layout.keyTemplate = resPath[2]
+			}
+			if len(resPath) > 3 {
+				fr.layout.pointerTemplate = resPath[3]
+			}
 			factsetRes = append(factsetRes, fr)
 		}
 	}
 	return factsetRes
 }
 
-func listen(h *httpHandler, port int) {
+// getKeyValues parses a comma separated list of key/value pairs
+func getKeyValues(list string, kvSeparator string) (map[string]string, error) {
+	values := map[string]string{}
+	if list == "" {
+		return values, nil
+	}
+	for _, pair := range strings.Split(list, resSeparator) {
+		kv := strings.SplitN(pair, kvSeparator, 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return values, fmt.Errorf("Invalid key/value pair [%s], expected key%svalue", pair, kvSeparator)
+		}
+		values[kv[0]] = kv[1]
+	}
+	return values, nil
+}
+
+func getStorageClasses(list string) (map[string]string, error) {
+	storageClasses, err := getKeyValues(list, ":")
+	if err != nil {
+		return storageClasses, err
+	}
+	return storageClasses, validateStorageClasses(storageClasses)
+}
+
+func validateStorageClasses(storageClasses map[string]string) error {
+	for kind := range storageClasses {
+		if kind != daily && kind != weekly && kind != manifestObjects && kind != pointerObjects {
+			return fmt.Errorf("Unknown object kind [%s], expected one of %s, %s, %s, %s", kind, daily, weekly, manifestObjects, pointerObjects)
+		}
+	}
+	return nil
+}
+
+func listen(h *httpHandler, port int, grace time.Duration) {
 	log.Infof("Listening on port: %d", port)
 	r := mux.NewRouter()
-	r.HandleFunc("/__health", v1a.Handler("Factset Reader Healthchecks", "Checks for accessing Factset server and Amazon S3 bucket", h.factsetHealthcheck(), h.amazonS3Healthcheck()))
+	r.HandleFunc("/__health", h.healthHandler())
+	if h.cache != nil {
+		h.cache.start()
+	}
 	gtgHandler := httphandlers.NewGoodToGoHandler(h.goodToGo)
 	r.HandleFunc(httphandlers.GTGPath, gtgHandler)
 	r.HandleFunc("/force-import", h.s.forceImport).Methods("POST")
 	r.HandleFunc("/force-import-weekly", h.s.forceImportWeekly).Methods("POST")
-	err := http.ListenAndServe(":"+strconv.Itoa(port), r)
-	if err != nil {
+	r.HandleFunc("/retention", h.s.enforceRetention).Methods("POST")
+	r.HandleFunc("/jobs", h.s.listJobs).Methods("GET")
+	r.HandleFunc("/jobs/{id}", h.s.getJob).Methods("GET")
+	r.HandleFunc("/jobs/{id}", h.s.cancelJob).Methods("DELETE")
+	r.HandleFunc("/remote", h.s.getRemote).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: ":" + strconv.Itoa(port), Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	log.Infof("Received %v, shutting down", waitForSignal())
+	h.shutdown(server, grace)
+}
+
+// shutdown stops the healthchecks and the import triggers, waits for or aborts the running jobs and then stops the server;
+// until then the jobs endpoints still report the jobs
+func (h *httpHandler) shutdown(server *http.Server, grace time.Duration) {
+	if h.cache != nil {
+		h.cache.stop()
+	}
+	if !h.s.jobs.shutdown(grace, abortTimeout) {
+		log.Errorf("Import jobs were still running %s after being aborted", abortTimeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
 		log.Error(err)
 	}
 }
+
+// shutdownOnSignal lets the running job of a one-shot command finish within grace once the process is asked to
+// terminate, and aborts it after that
+func shutdownOnSignal(jobs *jobRegistry, grace time.Duration) {
+	log.Infof("Received %v, shutting down", waitForSignal())
+	jobs.shutdown(grace, abortTimeout)
+}
+
+// waitForSignal blocks until the process is asked to terminate
+func waitForSignal() os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	return <-signals
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetKeyValues(t *testing.T) {
+	as := assert.New(t)
+
+	values, err := getKeyValues("team=content,data=factset=edm", "=")
+	as.NoError(err)
+	as.Equal(map[string]string{"team": "content", "data": "factset=edm"}, values)
+
+	values, err = getKeyValues("", "=")
+	as.NoError(err)
+	as.Empty(values)
+
+	_, err = getKeyValues("team", "=")
+	as.Error(err)
+}
+
+func TestGetStorageClassesRejectsUnknownKinds(t *testing.T) {
+	as := assert.New(t)
+
+	storageClasses, err := getStorageClasses("daily:STANDARD_IA,pointer:STANDARD")
+	as.NoError(err)
+	as.Equal(map[string]string{daily: "STANDARD_IA", pointerObjects: "STANDARD"}, storageClasses)
+
+	_, err = getStorageClasses("monthly:GLACIER")
+	as.Error(err)
+}
+
+func TestGetResourceListReadsResourceLayouts(t *testing.T) {
+	as := assert.New(t)
+
+	res := getResourceList("/datafeeds/edm/edm_premium/edm_premium:edm_entity.txt,/datafeeds/fundamentals/ff_basic/ff_basic:ff_sec.txt;ff_co.txt:factset/fundamentals/{kind}/{yyyy}/{mm}/{dd}/{file}:factset/fundamentals/{kind}")
+	as.Equal([]factsetResource{
+		{archive: "/datafeeds/edm/edm_premium/edm_premium", fileNames: "edm_entity.txt"},
+		{archive: "/datafeeds/fundamentals/ff_basic/ff_basic", fileNames: "ff_sec.txt;ff_co.txt",
+			layout: resourceLayout{keyTemplate: "factset/fundamentals/{kind}/{yyyy}/{mm}/{dd}/{file}", pointerTemplate: "factset/fundamentals/{kind}"}},
+	}, res)
+}
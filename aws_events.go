@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v6/pkg/credentials"
+)
+
+// snsPublisher publishes the event as the message of an SNS topic
+type snsPublisher struct {
+	endpoint string
+	topicARN string
+	region   string
+	creds    *credentials.Credentials
+	client   *http.Client
+}
+
+func newSNSPublisher(topicARN string, config s3Config) (snsPublisher, error) {
+	parts := strings.Split(topicARN, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" || parts[3] == "" {
+		return snsPublisher{}, fmt.Errorf("Invalid SNS topic ARN [%s]", topicARN)
+	}
+	creds, err := newS3Credentials(config)
+	if err != nil {
+		return snsPublisher{}, err
+	}
+	region := parts[3]
+	return snsPublisher{endpoint: "https://sns." + region + ".amazonaws.com/", topicARN: topicARN, region: region, creds: creds, client: &http.Client{Timeout: eventTimeout}}, nil
+}
+
+func (p snsPublisher) Publish(e publishEvent) error {
+	msg, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("Action", "Publish")
+	v.Set("Version", "2010-03-31")
+	v.Set("TopicArn", p.topicARN)
+	v.Set("Message", string(msg))
+	return postAWSQuery(p.client, p.creds, p.endpoint, p.region, "sns", v)
+}
+
+// sqsPublisher sends the event as a message to an SQS queue
+type sqsPublisher struct {
+	queueURL string
+	region   string
+	creds    *credentials.Credentials
+	client   *http.Client
+}
+
+func newSQSPublisher(queueURL string, config s3Config) (sqsPublisher, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Host == "" {
+		return sqsPublisher{}, fmt.Errorf("Invalid SQS queue url [%s]", queueURL)
+	}
+	region := config.region
+	// https://sqs.<region>.amazonaws.com/<account>/<queue> or the legacy https://<region>.queue.amazonaws.com/<account>/<queue>
+	host := strings.Split(u.Hostname(), ".")
+	if len(host) > 2 && host[0] == "sqs" {
+		region = host[1]
+	} else if len(host) > 2 && host[1] == "queue" {
+		region = host[0]
+	}
+	if region == "" {
+		return sqsPublisher{}, fmt.Errorf("Could not find the region of SQS queue [%s]", queueURL)
+	}
+	creds, err := newS3Credentials(config)
+	if err != nil {
+		return sqsPublisher{}, err
+	}
+	return sqsPublisher{queueURL: queueURL, region: region, creds: creds, client: &http.Client{Timeout: eventTimeout}}, nil
+}
+
+func (p sqsPublisher) Publish(e publishEvent) error {
+	msg, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("Action", "SendMessage")
+	v.Set("Version", "2012-11-05")
+	v.Set("MessageBody", string(msg))
+	return postAWSQuery(p.client, p.creds, p.queueURL, p.region, "sqs", v)
+}
+
+// postAWSQuery calls an action of an AWS query API, signed with signature version 4
+func postAWSQuery(client *http.Client, creds *credentials.Credentials, endpoint string, region string, service string, v url.Values) error {
+	c, err := creds.Get()
+	if err != nil {
+		return fmt.Errorf("Could not retrieve credentials: %v", err)
+	}
+	body := v.Encode()
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+	signV4(req, []byte(body), c, region, service, time.Now())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s failed: %s", service, v.Get("Action"), resp.Status)
+	}
+	return nil
+}
+
+// signV4 adds the date and the signature version 4 authorization to a request; the minio signer only signs for S3 and STS
+func signV4(req *http.Request, body []byte, c credentials.Value, region string, service string, t time.Time) {
+	t = t.UTC()
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonicalRequest := strings.Join([]string{req.Method, uri, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, sha256Hex(body)}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", t.Format("20060102T150405Z"), scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + c.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
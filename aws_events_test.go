@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignV4(t *testing.T) {
+	as := assert.New(t)
+
+	body := "Action=Publish&Message=%7B%22a%22%3A1%7D&TopicArn=arn&Version=2010-03-31"
+	req, err := http.NewRequest("POST", "https://sns.eu-west-1.amazonaws.com/", strings.NewReader(body))
+	as.NoError(err)
+	req.Header.Set("Content-Length", "72")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Amz-Security-Token", "tok")
+
+	signV4(req, []byte(body), credentials.Value{AccessKeyID: "AK", SecretAccessKey: "SK"}, "eu-west-1", "sns", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	as.Equal("20200102T030405Z", req.Header.Get("X-Amz-Date"))
+	as.Equal("AWS4-HMAC-SHA256 Credential=AK/20200102/eu-west-1/sns/aws4_request, "+
+		"SignedHeaders=content-length;content-type;host;x-amz-date;x-amz-security-token, "+
+		"Signature=171668ac734bea8636ed603401549fad5675c2967423ca19acfe3fcbc58f7f10", req.Header.Get("Authorization"))
+}
+
+func TestSNSPublisher(t *testing.T) {
+	as := assert.New(t)
+
+	var form map[string]string
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		as.NoError(req.ParseForm())
+		form = map[string]string{}
+		for k := range req.PostForm {
+			form[k] = req.PostForm.Get(k)
+		}
+		auth = req.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	p, err := newSNSPublisher("arn:aws:sns:eu-west-1:123456789012:factset-published", s3Config{accKey: "key", secretKey: "secret"})
+	as.NoError(err)
+	p.endpoint = server.URL
+
+	as.NoError(p.Publish(publishEvent{JobID: "job1", Bucket: "factset"}))
+	as.Equal("Publish", form["Action"])
+	as.Equal("arn:aws:sns:eu-west-1:123456789012:factset-published", form["TopicArn"])
+	as.Contains(form["Message"], `"jobId":"job1"`)
+	as.True(strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=key/"))
+	as.Contains(auth, "/eu-west-1/sns/aws4_request")
+}
+
+func TestNewSQSPublisherFindsRegion(t *testing.T) {
+	as := assert.New(t)
+	config := s3Config{accKey: "key", secretKey: "secret"}
+
+	p, err := newSQSPublisher("https://sqs.eu-west-1.amazonaws.com/123456789012/factset-published", config)
+	as.NoError(err)
+	as.Equal("eu-west-1", p.region)
+
+	p, err = newSQSPublisher("https://us-east-1.queue.amazonaws.com/123456789012/factset-published", config)
+	as.NoError(err)
+	as.Equal("us-east-1", p.region)
+
+	config.region = "eu-central-1"
+	p, err = newSQSPublisher("http://localhost:9324/queue/factset-published", config)
+	as.NoError(err)
+	as.Equal("eu-central-1", p.region)
+}
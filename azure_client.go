@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const azureAPIVersion = "2019-12-12"
+
+// AzureBlobClient stores the objects as block blobs of an Azure storage container, authorised with a SAS token.
+// Storage classes are mapped to the access tier of the blobs (Hot, Cool or Archive).
+type AzureBlobClient struct {
+	client    *http.Client
+	endpoint  string
+	container string
+	sasToken  string
+	tags      map[string]string
+}
+
+func NewAzureBlobClient(config s3Config) (S3Client, error) {
+	if err := validateAzureConfig(config); err != nil {
+		return nil, err
+	}
+	return &AzureBlobClient{
+		client:    &http.Client{},
+		endpoint:  "https://" + config.azureAccount + ".blob.core.windows.net",
+		container: config.bucket,
+		sasToken:  strings.TrimPrefix(config.azureSASToken, "?"),
+		tags:      config.tags,
+	}, nil
+}
+
+func validateAzureConfig(config s3Config) error {
+	if config.azureAccount == "" {
+		return errors.New("An account name is required for the azure storage backend")
+	}
+	if config.azureSASToken == "" {
+		return errors.New("A SAS token is required for the azure storage backend")
+	}
+	return nil
+}
+
+func (az *AzureBlobClient) url(objectName string, query string) string {
+	u := az.endpoint + "/" + az.container
+	if objectName != "" {
+		u += "/" + (&url.URL{Path: objectName}).EscapedPath()
+	}
+	u += "?" + az.sasToken
+	if query != "" {
+		u += "&" + query
+	}
+	return u
+}
+
+func (az *AzureBlobClient) do(ctx context.Context, method string, u string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	if body != nil {
+		req.ContentLength = size
+	}
+	return az.client.Do(req)
+}
+
+func (az *AzureBlobClient) PutObject(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	err = az.put(ctx, objectName, withProgress(f, opts.progress), info.Size(), opts, "application/octet-stream")
+	return info.Size(), err
+}
+
+func (az *AzureBlobClient) PutData(ctx context.Context, objectName string, data []byte, opts objectOptions) error {
+	return az.put(ctx, objectName, bytes.NewReader(data), int64(len(data)), opts, "text/plain")
+}
+
+func (az *AzureBlobClient) put(ctx context.Context, objectName string, body io.Reader, size int64, opts objectOptions, defaultContentType string) error {
+	header := http.Header{}
+	header.Set("x-ms-blob-type", "BlockBlob")
+	contentType := opts.contentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	header.Set("Content-Type", contentType)
+	if opts.storageClass != "" {
+		header.Set("x-ms-access-tier", opts.storageClass)
+	}
+	for k, v := range opts.metadata {
+		// metadata names have to be valid C# identifiers
+		header.Set("x-ms-meta-"+strings.Replace(k, "-", "_", -1), v)
+	}
+	if len(az.tags) > 0 {
+		tags := url.Values{}
+		for k, v := range az.tags {
+			tags.Set(k, v)
+		}
+		header.Set("x-ms-tags", tags.Encode())
+	}
+
+	resp, err := az.do(ctx, "PUT", az.url(objectName, ""), body, size, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("Could not upload blob [%s]: %s", objectName, resp.Status)
+	}
+	return nil
+}
+
+func (az *AzureBlobClient) GetData(ctx context.Context, objectName string) ([]byte, error) {
+	resp, err := az.do(ctx, "GET", az.url(objectName, ""), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errObjectNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not download blob [%s]: %s", objectName, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (az *AzureBlobClient) StatObject(ctx context.Context, objectName string) (objectInfo, error) {
+	resp, err := az.do(ctx, "HEAD", az.url(objectName, ""), nil, 0, nil)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return objectInfo{}, errObjectNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return objectInfo{}, fmt.Errorf("Could not read properties of blob [%s]: %s", objectName, resp.Status)
+	}
+	info := objectInfo{key: objectName, size: resp.ContentLength, etag: strings.Trim(resp.Header.Get("ETag"), "\""), metadata: map[string]string{}}
+	info.lastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	// the service computes Content-MD5 for blobs uploaded with a single PUT
+	if contentMD5, err := base64.StdEncoding.DecodeString(resp.Header.Get("Content-MD5")); err == nil && len(contentMD5) > 0 {
+		info.md5 = hex.EncodeToString(contentMD5)
+	}
+	for k := range resp.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-ms-meta-") {
+			name := strings.Replace(strings.TrimPrefix(strings.ToLower(k), "x-ms-meta-"), "_", "-", -1)
+			info.metadata[name] = resp.Header.Get(k)
+		}
+	}
+	return info, nil
+}
+
+func (az *AzureBlobClient) RemoveObject(ctx context.Context, objectName string) error {
+	resp, err := az.do(ctx, "DELETE", az.url(objectName, ""), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("Could not delete blob [%s]: %s", objectName, resp.Status)
+	}
+	return nil
+}
+
+type azureBlobList struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			LastModified  string `xml:"Last-Modified"`
+			ContentLength int64  `xml:"Content-Length"`
+			Etag          string `xml:"Etag"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+func (az *AzureBlobClient) ListObjects(ctx context.Context, prefix string) ([]objectInfo, error) {
+	var objects []objectInfo
+	marker := ""
+	for {
+		query := url.Values{}
+		query.Set("restype", "container")
+		query.Set("comp", "list")
+		query.Set("prefix", prefix)
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		list, err := az.listPage(ctx, query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range list.Blobs {
+			lastModified, _ := http.ParseTime(b.Properties.LastModified)
+			objects = append(objects, objectInfo{key: b.Name, size: b.Properties.ContentLength, etag: strings.Trim(b.Properties.Etag, "\""), lastModified: lastModified})
+		}
+		if list.NextMarker == "" {
+			return objects, nil
+		}
+		marker = list.NextMarker
+	}
+}
+
+func (az *AzureBlobClient) listPage(ctx context.Context, query string) (azureBlobList, error) {
+	list := azureBlobList{}
+	resp, err := az.do(ctx, "GET", az.url("", query), nil, 0, nil)
+	if err != nil {
+		return list, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return list, fmt.Errorf("Could not list blobs of container [%s]: %s", az.container, resp.Status)
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&list)
+	return list, err
+}
+
+func (az *AzureBlobClient) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	resp, err := az.do(ctx, "HEAD", az.url("", "restype=container"), nil, 0, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("Could not read properties of container [%s]: %s", az.container, resp.Status)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAzureBlobClientPutData(t *testing.T) {
+	as := assert.New(t)
+
+	var req *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	az := &AzureBlobClient{client: server.Client(), endpoint: server.URL, container: "factset", sasToken: "sv=2019-12-12&sig=abc",
+		tags: map[string]string{"team": "content"}}
+	err := az.PutData(context.Background(), "2017-01-01/daily", []byte("2017-01-01/daily.zip"), objectOptions{storageClass: "Cool", metadata: map[string]string{"job-id": "job1"}})
+	as.NoError(err)
+	as.Equal("PUT", req.Method)
+	as.Equal("/factset/2017-01-01/daily", req.URL.Path)
+	as.Equal("abc", req.URL.Query().Get("sig"))
+	as.Equal("BlockBlob", req.Header.Get("x-ms-blob-type"))
+	as.Equal("Cool", req.Header.Get("x-ms-access-tier"))
+	as.Equal("job1", req.Header.Get("x-ms-meta-job_id"))
+	as.Equal("team=content", req.Header.Get("x-ms-tags"))
+	as.Equal("text/plain", req.Header.Get("Content-Type"))
+	as.Equal("2017-01-01/daily.zip", string(body))
+}
+
+func TestAzureBlobClientNotFound(t *testing.T) {
+	as := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	az := &AzureBlobClient{client: server.Client(), endpoint: server.URL, container: "factset", sasToken: "sig=abc"}
+	_, err := az.GetData(context.Background(), "daily")
+	as.Equal(errObjectNotFound, err)
+	_, err = az.StatObject(context.Background(), "daily")
+	as.Equal(errObjectNotFound, err)
+	as.NoError(az.RemoveObject(context.Background(), "daily"))
+	exists, err := az.BucketExists(context.Background(), "factset")
+	as.NoError(err)
+	as.False(exists)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// exitFailed is the exit code of a one-shot command that did not succeed; mow.cli exits with 2 on invalid usage
+const exitFailed = 1
+
+// runImport runs an import while the command waits; in dry run mode the report is written to out instead
+func (s service) runImport(out io.Writer) error {
+	if len(s.files) == 0 {
+		return errors.New("No resources to import")
+	}
+	job, err := newImportJob(s.weekly)
+	if err != nil {
+		return err
+	}
+	if s.dryRun {
+		report, err := s.dryRunImport(context.Background(), job, true)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	ctx, err := s.jobs.start(job)
+	if err != nil {
+		return err
+	}
+	return s.fetchResources(ctx, job)
+}
+
+// listRemote writes the files of a directory on the Factset server to out
+func (s service) listRemote(dir string, out io.Writer) error {
+	files, err := s.readRemoteDir(context.Background(), dir)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tMODIFIED")
+	for _, f := range files {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", f.Name, f.Size, f.Modified.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// resolve writes the packages an import of the resource would download to out
+func (s service) resolve(resource string, isWeekly bool, out io.Writer) error {
+	res := getResourceList(resource)
+	if len(res) != 1 {
+		return fmt.Errorf("Invalid resource [%s], expected <archive>:<file names>", resource)
+	}
+	rd, err := NewReader(context.Background(), s.rdConfig, log.WithField(resourceField, res[0].archive))
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	archives, err := rd.Resolve(context.Background(), res[0], isWeekly)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tPUBLISHED\tBUNDLE")
+	for _, a := range archives {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", path.Join(a.dir, a.name), a.size, a.published.Format(time.RFC3339), bundleKind(a.name)+".zip")
+	}
+	return w.Flush()
+}
+
+// localBundles returns the daily and weekly zips found in a local folder
+func localBundles(src string) ([]string, error) {
+	var files []string
+	for _, kind := range []string{daily, weekly} {
+		fi, err := os.Stat(path.Join(src, kind+".zip"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a file", path.Join(src, kind+".zip"))
+		}
+		files = append(files, kind+".zip")
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Found no %s.zip or %s.zip in %s", daily, weekly, src)
+	}
+	return files, nil
+}
+
+// publishLocal uploads bundles zipped beforehand to the destinations, without reading from Factset; like an import,
+// it is aborted once the job registry shuts down
+func (s service) publishLocal(src string) error {
+	files, err := localBundles(src)
+	if err != nil {
+		return err
+	}
+	job, err := newImportJob(s.weekly)
+	if err != nil {
+		return err
+	}
+	job.published = job.started
+
+	var bundles []bundle
+	for _, f := range files {
+		m, err := newLocalManifest(job, src, f)
+		if err != nil {
+			return err
+		}
+		bundles = append(bundles, bundle{fileName: f, manifest: m})
+	}
+
+	l := jobLog(job.id)
+	wr, err := NewDestinationsWriter(s.writeDestinations(), s.destinationsPolicy, nil, l)
+	if err != nil {
+		return err
+	}
+	ctx, err := s.jobs.start(job)
+	if err != nil {
+		return err
+	}
+	l.Infof("Publishing %v from %s as job [%s]", files, src, job.id)
+	s.jobs.setPhase(job.id, uploadPhase)
+	err = wr.Write(ctx, src, bundles)
+	s.jobs.reportDestinations(job.id, wr.Results())
+	if err != nil && ctx.Err() != nil {
+		err = errJobAborted
+	}
+	s.jobs.finish(job.id, err)
+	return err
+}
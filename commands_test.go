@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalBundles(t *testing.T) {
+	as := assert.New(t)
+
+	src, err := ioutil.TempDir("", "publish")
+	as.NoError(err)
+	defer os.RemoveAll(src)
+
+	_, err = localBundles(src)
+	as.Error(err)
+
+	as.NoError(ioutil.WriteFile(filepath.Join(src, "weekly.zip"), []byte("zip"), 0644))
+	as.NoError(ioutil.WriteFile(filepath.Join(src, "other.zip"), []byte("zip"), 0644))
+	files, err := localBundles(src)
+	as.NoError(err)
+	as.Equal([]string{"weekly.zip"}, files)
+
+	as.NoError(os.Mkdir(filepath.Join(src, "daily.zip"), 0755))
+	_, err = localBundles(src)
+	as.Error(err)
+}
+
+func TestRunImportWithoutResources(t *testing.T) {
+	as := assert.New(t)
+
+	s := service{jobs: newJobRegistry(defaultJobHistory)}
+	as.Error(s.runImport(ioutil.Discard))
+	as.Empty(s.jobs.list())
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/minio/minio-go/v6/pkg/signer"
+)
+
+const (
+	staticCredentials  = "static"
+	envCredentials     = "env"
+	profileCredentials = "profile"
+	iamCredentials     = "iam"
+	chainCredentials   = "chain"
+)
+
+const defaultSTSEndpoint = "https://sts.amazonaws.com"
+const defaultRoleSessionName = "factset-reader"
+const assumeRoleDuration = time.Hour
+
+// newS3Credentials returns the credentials selected in the config, optionally used to assume a role via STS
+func newS3Credentials(config s3Config) (*credentials.Credentials, error) {
+	var creds *credentials.Credentials
+	switch config.credentials {
+	case "", staticCredentials:
+		creds = credentials.NewStaticV4(config.accKey, config.secretKey, "")
+	case envCredentials:
+		creds = credentials.NewEnvAWS()
+	case profileCredentials:
+		creds = credentials.NewFileAWSCredentials("", config.profile)
+	case iamCredentials:
+		// covers the EC2 and ECS metadata endpoints, and EKS web identity tokens (AWS_WEB_IDENTITY_TOKEN_FILE)
+		creds = credentials.NewIAM("")
+	case chainCredentials:
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{Profile: config.profile},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	default:
+		return nil, fmt.Errorf("Unknown credentials [%s], expected one of %s, %s, %s, %s, %s", config.credentials,
+			staticCredentials, envCredentials, profileCredentials, iamCredentials, chainCredentials)
+	}
+
+	if config.roleARN == "" {
+		return creds, nil
+	}
+	stsEndpoint := config.stsEndpoint
+	if stsEndpoint == "" {
+		stsEndpoint = defaultSTSEndpoint
+	}
+	if _, err := url.Parse(stsEndpoint); err != nil {
+		return nil, fmt.Errorf("Invalid STS endpoint [%s]: %v", stsEndpoint, err)
+	}
+	sessionName := config.roleSessionName
+	if sessionName == "" {
+		sessionName = defaultRoleSessionName
+	}
+	return credentials.New(&assumeRoleProvider{
+		client:      &http.Client{Transport: http.DefaultTransport},
+		source:      creds,
+		stsEndpoint: stsEndpoint,
+		region:      config.region,
+		roleARN:     config.roleARN,
+		sessionName: sessionName,
+	}), nil
+}
+
+// assumeRoleProvider assumes a role with whatever the source credentials are at the time of the call,
+// so it keeps working when the source credentials are temporary ones themselves
+type assumeRoleProvider struct {
+	credentials.Expiry
+	client      *http.Client
+	source      *credentials.Credentials
+	stsEndpoint string
+	region      string
+	roleARN     string
+	sessionName string
+}
+
+// stsSigningRegion returns the region STS requests to host are signed for: us-east-1 for the global endpoint,
+// the region in the name of a regional AWS endpoint, and the S3 region for any other endpoint
+func stsSigningRegion(host string, region string) string {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	parts := strings.Split(host, ".")
+	switch {
+	case host == "sts.amazonaws.com":
+		return "us-east-1"
+	case len(parts) >= 4 && (parts[0] == "sts" || parts[0] == "sts-fips") && parts[2] == "amazonaws":
+		return parts[1]
+	case region != "":
+		return region
+	}
+	return "us-east-1"
+}
+
+func (p *assumeRoleProvider) Retrieve() (credentials.Value, error) {
+	source, err := p.source.Get()
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("Could not retrieve credentials to assume role [%s]: %v", p.roleARN, err)
+	}
+
+	v := url.Values{}
+	v.Set("Action", "AssumeRole")
+	v.Set("Version", "2011-06-15")
+	v.Set("RoleArn", p.roleARN)
+	v.Set("RoleSessionName", p.sessionName)
+	v.Set("DurationSeconds", strconv.Itoa(int(assumeRoleDuration.Seconds())))
+	body := v.Encode()
+	hash := sha256.Sum256([]byte(body))
+
+	u, err := url.Parse(p.stsEndpoint)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	u.Path = "/"
+	req, err := http.NewRequest("POST", u.String(), strings.NewReader(body))
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	if source.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", source.SessionToken)
+	}
+	req = signer.SignV4STS(*req, source.AccessKeyID, source.SecretAccessKey, stsSigningRegion(u.Host, p.region))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return credentials.Value{}, fmt.Errorf("Could not assume role [%s]: %s", p.roleARN, resp.Status)
+	}
+
+	a := credentials.AssumeRoleResponse{}
+	if err = xml.NewDecoder(resp.Body).Decode(&a); err != nil {
+		return credentials.Value{}, err
+	}
+	c := a.Result.Credentials
+	if c.AccessKey == "" || c.SecretKey == "" {
+		return credentials.Value{}, errors.New("STS returned no credentials for role " + p.roleARN)
+	}
+	p.SetExpiration(c.Expiration, credentials.DefaultExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     c.AccessKey,
+		SecretAccessKey: c.SecretKey,
+		SessionToken:    c.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
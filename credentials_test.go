@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAROLE</AccessKeyId>
+      <SecretAccessKey>roleSecret</SecretAccessKey>
+      <SessionToken>roleToken</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`
+
+func TestNewS3CredentialsDefaultsToStaticKeys(t *testing.T) {
+	as := assert.New(t)
+
+	creds, err := newS3Credentials(s3Config{accKey: "key", secretKey: "secret"})
+	as.NoError(err)
+	v, err := creds.Get()
+	as.NoError(err)
+	as.Equal("key", v.AccessKeyID)
+	as.Equal("secret", v.SecretAccessKey)
+}
+
+func TestNewS3CredentialsRejectsUnknownSource(t *testing.T) {
+	_, err := newS3Credentials(s3Config{credentials: "vault"})
+	assert.Error(t, err)
+}
+
+func TestNewS3CredentialsAssumesRoleWithSourceCredentials(t *testing.T) {
+	as := assert.New(t)
+
+	var form url.Values
+	var securityToken, authorization string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		securityToken = r.Header.Get("X-Amz-Security-Token")
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(assumeRoleResponse))
+	}))
+	defer sts.Close()
+
+	config := s3Config{
+		accKey:      "ASIASOURCE",
+		secretKey:   "sourceSecret",
+		roleARN:     "arn:aws:iam::123456789012:role/factset",
+		stsEndpoint: sts.URL,
+	}
+	creds, err := newS3Credentials(config)
+	as.NoError(err)
+	v, err := creds.Get()
+	as.NoError(err)
+	as.Equal("ASIAROLE", v.AccessKeyID)
+	as.Equal("roleSecret", v.SecretAccessKey)
+	as.Equal("roleToken", v.SessionToken)
+	as.False(creds.IsExpired())
+
+	as.Equal("AssumeRole", form.Get("Action"))
+	as.Equal("arn:aws:iam::123456789012:role/factset", form.Get("RoleArn"))
+	as.Equal(defaultRoleSessionName, form.Get("RoleSessionName"))
+	as.Empty(securityToken)
+	as.Contains(authorization, "Credential=ASIASOURCE/")
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestAssumeRoleSignsForTheRegionOfTheSTSEndpoint(t *testing.T) {
+	as := assert.New(t)
+
+	var authorization string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		authorization = r.Header.Get("Authorization")
+		return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: ioutil.NopCloser(strings.NewReader(assumeRoleResponse))}, nil
+	})}
+	for endpoint, scope := range map[string]string{
+		defaultSTSEndpoint:                    "/us-east-1/sts/aws4_request",
+		"https://sts.eu-west-1.amazonaws.com": "/eu-west-1/sts/aws4_request",
+		"https://sts.us-west-2.amazonaws.com": "/us-west-2/sts/aws4_request",
+		"http://localhost:9000":               "/eu-west-1/sts/aws4_request",
+	} {
+		p := &assumeRoleProvider{
+			client:      client,
+			source:      credentials.NewStaticV4("ASIASOURCE", "sourceSecret", ""),
+			stsEndpoint: endpoint,
+			region:      "eu-west-1",
+			roleARN:     "arn:aws:iam::123456789012:role/factset",
+			sessionName: defaultRoleSessionName,
+		}
+		_, err := p.Retrieve()
+		as.NoError(err)
+		as.Contains(authorization, "Credential=ASIASOURCE/", endpoint)
+		as.Contains(authorization, scope, endpoint)
+	}
+}
+
+func TestAssumeRoleFailsWhenSTSRefuses(t *testing.T) {
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer sts.Close()
+
+	creds, err := newS3Credentials(s3Config{accKey: "key", secretKey: "secret", roleARN: "arn:aws:iam::123456789012:role/factset", stsEndpoint: sts.URL})
+	assert.NoError(t, err)
+	_, err = creds.Get()
+	assert.Error(t, err)
+}
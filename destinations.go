@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// policies deciding whether an import that reached only some destinations succeeded
+const (
+	allDestinations    = "all"
+	anyDestination     = "any"
+	primaryDestination = "primary"
+)
+
+const primaryDestinationName = "primary"
+
+type destination struct {
+	name   string
+	config s3Config
+}
+
+// destinationOverrides is the JSON form of an additional destination; fields not set are taken from the primary destination.
+// The part size is in MiB, as for the s3-part-size argument.
+type destinationOverrides struct {
+	Name                 string            `json:"name"`
+	Backend              string            `json:"backend"`
+	AccessKey            string            `json:"accessKey"`
+	SecretKey            string            `json:"secretKey"`
+	Bucket               string            `json:"bucket"`
+	Domain               string            `json:"domain"`
+	Region               string            `json:"region"`
+	KeyTemplate          string            `json:"keyTemplate"`
+	PointerTemplate      string            `json:"pointerTemplate"`
+	Env                  string            `json:"env"`
+	SSE                  string            `json:"sse"`
+	KMSKeyID             string            `json:"kmsKeyId"`
+	StorageClasses       map[string]string `json:"storageClasses"`
+	Tags                 map[string]string `json:"tags"`
+	Credentials          string            `json:"credentials"`
+	Profile              string            `json:"profile"`
+	RoleARN              string            `json:"roleArn"`
+	RoleSessionName      string            `json:"roleSessionName"`
+	STSEndpoint          string            `json:"stsEndpoint"`
+	AzureAccount         string            `json:"azureAccount"`
+	AzureSASToken        string            `json:"azureSasToken"`
+	SFTPPushAddress      string            `json:"sftpPushAddress"`
+	SFTPPushPort         *int              `json:"sftpPushPort"`
+	SFTPPushUsername     string            `json:"sftpPushUsername"`
+	SFTPPushKey          string            `json:"sftpPushKey"`
+	UploadAttempts       *int              `json:"uploadAttempts"`
+	PartSize             *int              `json:"partSize"`
+	UploadThreads        *int              `json:"uploadThreads"`
+	MaxRetries           *int              `json:"maxRetries"` // only to reject it, see setS3MaxRetries
+	RetentionDailyDays   *int              `json:"retentionDailyDays"`
+	RetentionWeeklyCount *int              `json:"retentionWeeklyCount"`
+}
+
+// getDestinations returns the primary destination followed by the additional destinations given as a JSON array
+func getDestinations(primary s3Config, list string) ([]destination, error) {
+	destinations := []destination{{name: primaryDestinationName, config: primary}}
+	if strings.TrimSpace(list) == "" {
+		return destinations, nil
+	}
+	var overrides []destinationOverrides
+	if err := json.Unmarshal([]byte(list), &overrides); err != nil {
+		return nil, fmt.Errorf("Invalid destinations: %v", err)
+	}
+	names := map[string]bool{primaryDestinationName: true}
+	for _, o := range overrides {
+		if o.Name == "" {
+			return nil, errors.New("Every destination needs a name")
+		}
+		if names[o.Name] {
+			return nil, fmt.Errorf("Duplicate destination name [%s]", o.Name)
+		}
+		names[o.Name] = true
+		if o.MaxRetries != nil {
+			return nil, fmt.Errorf("Destination [%s]: maxRetries cannot be set per destination, s3-max-retries applies to all", o.Name)
+		}
+		if err := validateStorageClasses(o.StorageClasses); err != nil {
+			return nil, fmt.Errorf("Destination [%s]: %v", o.Name, err)
+		}
+		destinations = append(destinations, destination{name: o.Name, config: o.apply(primary)})
+	}
+	return destinations, nil
+}
+
+func (o destinationOverrides) apply(config s3Config) s3Config {
+	override := func(value *string, with string) {
+		if with != "" {
+			*value = with
+		}
+	}
+	overrideInt := func(value *int, with *int) {
+		if with != nil {
+			*value = *with
+		}
+	}
+	override(&config.backend, o.Backend)
+	override(&config.accKey, o.AccessKey)
+	override(&config.secretKey, o.SecretKey)
+	override(&config.bucket, o.Bucket)
+	override(&config.domain, o.Domain)
+	override(&config.region, o.Region)
+	override(&config.keyTemplate, o.KeyTemplate)
+	override(&config.pointerTemplate, o.PointerTemplate)
+	override(&config.env, o.Env)
+	override(&config.sse, o.SSE)
+	override(&config.kmsKeyID, o.KMSKeyID)
+	override(&config.credentials, o.Credentials)
+	override(&config.profile, o.Profile)
+	override(&config.roleARN, o.RoleARN)
+	override(&config.roleSessionName, o.RoleSessionName)
+	override(&config.stsEndpoint, o.STSEndpoint)
+	override(&config.azureAccount, o.AzureAccount)
+	override(&config.azureSASToken, o.AzureSASToken)
+	override(&config.sftpPush.address, o.SFTPPushAddress)
+	overrideInt(&config.sftpPush.port, o.SFTPPushPort)
+	override(&config.sftpPush.username, o.SFTPPushUsername)
+	override(&config.sftpPush.key, o.SFTPPushKey)
+	if o.StorageClasses != nil {
+		config.storageClasses = o.StorageClasses
+	}
+	if o.Tags != nil {
+		config.tags = o.Tags
+	}
+	overrideInt(&config.uploadAttempts, o.UploadAttempts)
+	if o.PartSize != nil {
+		config.partSize = int64(*o.PartSize) * 1024 * 1024
+	}
+	overrideInt(&config.uploadThreads, o.UploadThreads)
+	overrideInt(&config.retention.dailyDays, o.RetentionDailyDays)
+	overrideInt(&config.retention.weeklyCount, o.RetentionWeeklyCount)
+	return config
+}
+
+func validateDestinationsPolicy(policy string) error {
+	switch policy {
+	case allDestinations, anyDestination, primaryDestination:
+		return nil
+	}
+	return fmt.Errorf("Unknown destinations policy [%s], expected one of %s, %s, %s", policy, allDestinations, anyDestination, primaryDestination)
+}
+
+type destinationResult struct {
+	name string
+	err  error
+}
+
+type destinationWriter struct {
+	name   string
+	writer Writer
+	err    error
+}
+
+// DestinationsWriter publishes the same bundles to several destinations in parallel
+type DestinationsWriter struct {
+	writers []destinationWriter
+	policy  string
+	results []destinationResult
+	log     *log.Entry
+}
+
+// NewDestinationsWriter creates a writer per destination; a destination whose writer cannot be
+// created counts as failed when writing, so it does not stop the others
+func NewDestinationsWriter(destinations []destination, policy string, progress func(destination string, object string, uploaded int64, size int64), logger *log.Entry) (*DestinationsWriter, error) {
+	if len(destinations) == 0 {
+		return nil, errors.New("No destinations configured")
+	}
+	if policy == "" {
+		policy = allDestinations
+	}
+	if err := validateDestinationsPolicy(policy); err != nil {
+		return nil, err
+	}
+	logger = orDefaultLog(logger)
+	dw := &DestinationsWriter{policy: policy, log: logger}
+	for _, d := range destinations {
+		var destinationProgress uploadProgressFunc
+		if progress != nil {
+			name := d.name
+			destinationProgress = func(object string, uploaded int64, size int64) {
+				progress(name, object, uploaded, size)
+			}
+		}
+		config := d.config
+		config.destination = d.name
+		wr, err := NewWriter(config, destinationProgress, logger.WithField(destinationField, d.name))
+		dw.writers = append(dw.writers, destinationWriter{name: d.name, writer: wr, err: err})
+	}
+	return dw, nil
+}
+
+func (dw *DestinationsWriter) Write(ctx context.Context, src string, bundles []bundle) error {
+	results := make([]destinationResult, len(dw.writers))
+	var wg sync.WaitGroup
+	for i, w := range dw.writers {
+		results[i].name = w.name
+		if w.err != nil {
+			results[i].err = w.err
+			continue
+		}
+		wg.Add(1)
+		go func(i int, w Writer) {
+			defer wg.Done()
+			results[i].err = w.Write(ctx, src, bundles)
+		}(i, w.writer)
+	}
+	wg.Wait()
+	dw.results = results
+
+	var failed []string
+	for _, r := range results {
+		if r.err != nil {
+			dw.logger().WithField(destinationField, r.name).Errorf("Publishing to destination [%s] failed: %v", r.name, r.err)
+			failed = append(failed, r.name)
+		} else {
+			dw.logger().WithField(destinationField, r.name).Infof("Published to destination [%s] successfully", r.name)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("Publishing failed for destinations %v", failed)
+	switch dw.policy {
+	case anyDestination:
+		if len(failed) < len(results) {
+			dw.logger().Warnf("%v, accepted by the %s policy", err, dw.policy)
+			return nil
+		}
+	case primaryDestination:
+		if results[0].err == nil {
+			dw.logger().Warnf("%v, accepted by the %s policy", err, dw.policy)
+			return nil
+		}
+	}
+	return err
+}
+
+func (dw *DestinationsWriter) logger() *log.Entry {
+	return orDefaultLog(dw.log)
+}
+
+// Results returns the outcome per destination of the last Write
+func (dw *DestinationsWriter) Results() []destinationResult {
+	return dw.results
+}
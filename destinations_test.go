@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDestinations(t *testing.T) {
+	as := assert.New(t)
+
+	primary := s3Config{bucket: "factset", region: "eu-west-1", sse: sseS3}
+	dests, err := getDestinations(primary, `[{"name":"dr","bucket":"factset-dr","region":"eu-central-1"}]`)
+	as.NoError(err)
+	as.Len(dests, 2)
+	as.Equal(primaryDestinationName, dests[0].name)
+	as.Equal(primary, dests[0].config)
+	as.Equal("dr", dests[1].name)
+	as.Equal("factset-dr", dests[1].config.bucket)
+	as.Equal("eu-central-1", dests[1].config.region)
+	as.Equal(sseS3, dests[1].config.sse)
+
+	dests, err = getDestinations(primary, `[{"name":"onprem","backend":"sftp","sftpPushAddress":"sftp.example.com","sftpPushPort":2222,
+		"storageClasses":{"weekly":"GLACIER"},"tags":{"team":"data"},"partSize":16,"uploadThreads":1,"uploadAttempts":5}]`)
+	as.NoError(err)
+	as.Equal(sftpConfig{address: "sftp.example.com", port: 2222}, dests[1].config.sftpPush)
+	as.Equal(map[string]string{"weekly": "GLACIER"}, dests[1].config.storageClasses)
+	as.Equal(map[string]string{"team": "data"}, dests[1].config.tags)
+	as.Equal(int64(16*1024*1024), dests[1].config.partSize)
+	as.Equal(1, dests[1].config.uploadThreads)
+	as.Equal(5, dests[1].config.uploadAttempts)
+
+	dests, err = getDestinations(primary, "")
+	as.NoError(err)
+	as.Len(dests, 1)
+
+	_, err = getDestinations(primary, `[{"name":"dr","storageClasses":{"monthly":"GLACIER"}}]`)
+	as.Error(err)
+	_, err = getDestinations(primary, `[{"name":"dr","maxRetries":3}]`)
+	as.Error(err)
+
+	_, err = getDestinations(primary, `[{"bucket":"factset-dr"}]`)
+	as.Error(err)
+	_, err = getDestinations(primary, `[{"name":"primary"}]`)
+	as.Error(err)
+	_, err = getDestinations(primary, `{"name":"dr"}`)
+	as.Error(err)
+}
+
+func newTestDestinationsWriter(policy string, errs ...error) *DestinationsWriter {
+	dw := &DestinationsWriter{policy: policy}
+	for i, err := range errs {
+		err := err
+		dw.writers = append(dw.writers, destinationWriter{name: string(rune('a' + i)), writer: &writerMock{
+			writeMock: func(ctx context.Context, src string, bundles []bundle) error {
+				return err
+			},
+		}})
+	}
+	return dw
+}
+
+func TestDestinationsWriterPolicies(t *testing.T) {
+	as := assert.New(t)
+	failure := errors.New("Connection refused")
+
+	dw := newTestDestinationsWriter(allDestinations, nil, nil)
+	as.NoError(dw.Write(context.Background(), dataFolder, nil))
+
+	dw = newTestDestinationsWriter(allDestinations, nil, failure)
+	as.Error(dw.Write(context.Background(), dataFolder, nil))
+	as.Equal([]destinationResult{{name: "a"}, {name: "b", err: failure}}, dw.Results())
+
+	dw = newTestDestinationsWriter(anyDestination, failure, nil)
+	as.NoError(dw.Write(context.Background(), dataFolder, nil))
+
+	dw = newTestDestinationsWriter(anyDestination, failure, failure)
+	as.Error(dw.Write(context.Background(), dataFolder, nil))
+
+	dw = newTestDestinationsWriter(primaryDestination, nil, failure)
+	as.NoError(dw.Write(context.Background(), dataFolder, nil))
+
+	dw = newTestDestinationsWriter(primaryDestination, failure, nil)
+	as.Error(dw.Write(context.Background(), dataFolder, nil))
+}
+
+func TestDestinationsWriterWritesAllDestinations(t *testing.T) {
+	as := assert.New(t)
+
+	dw := newTestDestinationsWriter(allDestinations, errors.New("Connection refused"))
+	dw.writers = append(dw.writers, destinationWriter{name: "broken", err: errors.New("Invalid key template")})
+	as.Error(dw.Write(context.Background(), dataFolder, nil))
+	as.Len(dw.Results(), 2)
+	as.Error(dw.Results()[1].err)
+
+	_, err := NewDestinationsWriter(nil, allDestinations, nil, nil)
+	as.Error(err)
+	_, err = NewDestinationsWriter([]destination{{name: primaryDestinationName}}, "some", nil, nil)
+	as.Error(err)
+}
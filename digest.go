@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// sha256Metadata is the metadata key under which the SHA-256 of an uploaded object is stored
+const sha256Metadata = "sha256"
+
+// checkStored reads back a file stored by the fs or sftp backend and compares it with the SHA-256 of the bytes written
+func checkStored(objectName string, stored io.Reader, written []byte) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, stored); err != nil {
+		return fmt.Errorf("Could not read back [%s]: %v", objectName, err)
+	}
+	if !bytes.Equal(h.Sum(nil), written) {
+		return fmt.Errorf("Stored file [%s] does not hold the bytes written", objectName)
+	}
+	return nil
+}
+
+// fileETag identifies a version of a file of the fs or sftp backend by its modification time and size
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+}
+
+// digest describes local content, to be compared with what the storage backend reports after an upload;
+// the content itself is kept (as path or data) for checksums that depend on how it was uploaded
+type digest struct {
+	size   int64
+	md5    string
+	sha256 string
+	path   string
+	data   []byte
+}
+
+func fileDigest(filePath string) (digest, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return digest{}, err
+	}
+	defer f.Close()
+	d, err := readDigest(f)
+	d.path = filePath
+	return d, err
+}
+
+func dataDigest(data []byte) digest {
+	d, _ := readDigest(bytes.NewReader(data))
+	d.data = data
+	return d
+}
+
+// multipartETag returns the ETag S3 gives the content uploaded in parts of partSize:
+// the MD5 of the MD5s of all parts, followed by the number of parts
+func (d digest) multipartETag(partSize int64) (string, error) {
+	var r io.Reader = bytes.NewReader(d.data)
+	if d.path != "" {
+		f, err := os.Open(d.path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+	var sums []byte
+	parts := 0
+	for {
+		h := md5.New()
+		n, err := io.CopyN(h, r, partSize)
+		if n > 0 {
+			sums = append(sums, h.Sum(nil)...)
+			parts++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts), nil
+}
+
+func readDigest(r io.Reader) (digest, error) {
+	m := md5.New()
+	s := sha256.New()
+	n, err := io.Copy(io.MultiWriter(m, s), r)
+	if err != nil {
+		return digest{}, err
+	}
+	return digest{size: n, md5: hex.EncodeToString(m.Sum(nil)), sha256: hex.EncodeToString(s.Sum(nil))}, nil
+}
+
+// withDigest returns a copy of the metadata with the SHA-256 of the object added
+func withDigest(metadata map[string]string, d digest) map[string]string {
+	m := map[string]string{}
+	for k, v := range metadata {
+		m[k] = v
+	}
+	m[sha256Metadata] = d.sha256
+	return m
+}
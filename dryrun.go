@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// dryRunReport describes what an import would do, without writing anything to the destinations
+type dryRunReport struct {
+	JobID           string           `json:"jobId"`
+	Weekly          bool             `json:"weekly"`
+	PublicationDate time.Time        `json:"publicationDate"`
+	Resources       []dryRunResource `json:"resources"`
+	Uploads         []dryRunUpload   `json:"uploads"`
+}
+
+type dryRunResource struct {
+	Archive  string          `json:"archive"`
+	Files    []string        `json:"files"`
+	Packages []dryRunPackage `json:"packages"`
+	Error    string          `json:"error,omitempty"`
+}
+
+type dryRunPackage struct {
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	Published    time.Time `json:"published"`
+	MajorVersion int       `json:"majorVersion"`
+	MinorVersion int       `json:"minorVersion"`
+	Bundle       string    `json:"bundle"`
+	Contents     []string  `json:"contents,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+type dryRunUpload struct {
+	Destination string `json:"destination"`
+	Bundle      string `json:"bundle"`
+	Key         string `json:"key"`
+	Manifest    string `json:"manifest"`
+	Pointer     string `json:"pointer"`
+}
+
+// dryRunImport resolves the packages an import would take from Factset and the keys it would write them to.
+// With inspect the packages are downloaded to a temporary folder to list the files the import would extract.
+func (s service) dryRunImport(ctx context.Context, job importJob, inspect bool) (dryRunReport, error) {
+	report := dryRunReport{JobID: job.id, Weekly: job.weekly, Resources: []dryRunResource{}, Uploads: []dryRunUpload{}}
+	rd, err := NewReader(ctx, s.rdConfig, jobLog(job.id))
+	if err != nil {
+		return report, err
+	}
+	defer rd.Close()
+
+	tmpDir := ""
+	if inspect {
+		tmpDir, err = ioutil.TempDir("", "factset-dry-run")
+		if err != nil {
+			return report, err
+		}
+		defer os.RemoveAll(tmpDir)
+	}
+
+	var colls []zipCollection
+	groupColls := map[resourceLayout][]zipCollection{}
+	versions := FactsetReader{}
+	for _, res := range s.files {
+		r := dryRunResource{Archive: res.archive, Files: strings.Split(res.fileNames, ";"), Packages: []dryRunPackage{}}
+		archives, err := rd.Resolve(ctx, res, job.weekly)
+		if err != nil {
+			r.Error = err.Error()
+			report.Resources = append(report.Resources, r)
+			continue
+		}
+		for _, a := range archives {
+			p := dryRunPackage{Name: a.name, Size: a.size, Published: a.published, Bundle: bundleKind(a.name) + ".zip"}
+			p.MajorVersion, _ = versions.getMajorVersion(a.name)
+			p.MinorVersion, _ = versions.getMinorVersion(a.name)
+			if inspect {
+				p.Contents, err = rd.Inspect(ctx, res, a, tmpDir)
+				if err != nil {
+					p.Error = err.Error()
+				}
+			}
+			r.Packages = append(r.Packages, p)
+			colls = append(colls, zipCollection{archive: a.name, published: a.published})
+			groupColls[res.layout] = append(groupColls[res.layout], zipCollection{archive: a.name, published: a.published})
+		}
+		report.Resources = append(report.Resources, r)
+	}
+
+	report.PublicationDate = publicationDate(colls, job.started)
+	// resources with a layout of their own are published as bundles of their own, under their own publication date
+	for _, g := range groupResources(s.files) {
+		date := publicationDate(groupColls[g.layout], job.started)
+		for _, d := range s.writeDestinations() {
+			layout, err := g.layout.keys(d.config)
+			if err != nil {
+				return report, err
+			}
+			for _, kind := range dryRunBundles(groupColls[g.layout], job.weekly) {
+				bundle := kind + ".zip"
+				report.Uploads = append(report.Uploads, dryRunUpload{
+					Destination: d.name,
+					Bundle:      bundle,
+					Key:         layout.dataKey(kind, bundle, job.id, date),
+					Manifest:    layout.dataKey(kind, manifestName(bundle), job.id, date),
+					Pointer:     layout.pointerKey(kind),
+				})
+			}
+		}
+	}
+	jobLog(job.id).Infof("Dry run [%s] would upload %d files", job.id, len(report.Uploads))
+	return report, nil
+}
+
+// dryRunBundles returns the kinds of bundles sortAndZipFiles would create from the packages
+func dryRunBundles(colls []zipCollection, isWeekly bool) []string {
+	if len(colls) == 0 {
+		return []string{}
+	}
+	if isWeekly {
+		return []string{weekly}
+	}
+	for _, coll := range colls {
+		if bundleKind(coll.archive) == weekly {
+			return []string{daily, weekly}
+		}
+	}
+	return []string{daily}
+}
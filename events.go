@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/segmentio/kafka-go"
+)
+
+const eventTimeout = 10 * time.Second
+
+// publishEvent tells consumers that new bundles were published to a destination
+type publishEvent struct {
+	JobID           string            `json:"jobId"`
+	Destination     string            `json:"destination"`
+	Backend         string            `json:"backend"`
+	Bucket          string            `json:"bucket"`
+	PublicationDate time.Time         `json:"publicationDate"`
+	Published       time.Time         `json:"published"`
+	Bundles         []publishedBundle `json:"bundles"`
+}
+
+type publishedBundle struct {
+	Kind     string            `json:"kind"`
+	Key      string            `json:"key"`
+	Manifest string            `json:"manifest"`
+	Pointer  string            `json:"pointer"`
+	Packages []manifestArchive `json:"packages"`
+}
+
+type eventPublisher interface {
+	Publish(e publishEvent) error
+}
+
+// httpPublisher posts the event as JSON
+type httpPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func (p httpPublisher) Publish(e publishEvent) error {
+	return postJSON(context.Background(), p.client, p.url, e)
+}
+
+// kafkaPublisher produces the event to a Kafka topic, keyed by the job ID
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func (p kafkaPublisher) Publish(e publishEvent) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	return p.writer.WriteMessages(ctx, kafka.Message{Key: []byte(e.JobID), Value: value})
+}
+
+// eventsConfig holds the settings of the publish events; SNS and SQS use the credentials of the primary destination
+type eventsConfig struct {
+	httpURL      string
+	kafkaBrokers string
+	kafkaTopic   string
+	snsTopicARN  string
+	sqsQueueURL  string
+	aws          s3Config
+}
+
+// eventEmitter sends the publish events to every configured publisher
+type eventEmitter struct {
+	publishers []eventPublisher
+}
+
+func newEventEmitter(config eventsConfig) (*eventEmitter, error) {
+	ee := &eventEmitter{}
+	if config.httpURL != "" {
+		ee.publishers = append(ee.publishers, httpPublisher{url: config.httpURL, client: &http.Client{Timeout: eventTimeout}})
+	}
+	if config.kafkaBrokers != "" || config.kafkaTopic != "" {
+		if config.kafkaBrokers == "" || config.kafkaTopic == "" {
+			return nil, errors.New("Kafka events need brokers and a topic")
+		}
+		var brokers []string
+		for _, b := range strings.Split(config.kafkaBrokers, ",") {
+			brokers = append(brokers, strings.TrimSpace(b))
+		}
+		ee.publishers = append(ee.publishers, kafkaPublisher{writer: kafka.NewWriter(kafka.WriterConfig{Brokers: brokers, Topic: config.kafkaTopic})})
+	}
+	if config.snsTopicARN != "" {
+		p, err := newSNSPublisher(config.snsTopicARN, config.aws)
+		if err != nil {
+			return nil, err
+		}
+		ee.publishers = append(ee.publishers, p)
+	}
+	if config.sqsQueueURL != "" {
+		p, err := newSQSPublisher(config.sqsQueueURL, config.aws)
+		if err != nil {
+			return nil, err
+		}
+		ee.publishers = append(ee.publishers, p)
+	}
+	return ee, nil
+}
+
+// emit publishes the event; the bundles are already published, so failing to tell consumers does not fail the import
+func (ee *eventEmitter) emit(e publishEvent, l *log.Entry) {
+	if ee == nil {
+		return
+	}
+	for _, p := range ee.publishers {
+		if err := p.Publish(e); err != nil {
+			l.Errorf("Could not publish event of job [%s]: %v", e.JobID, err)
+		}
+	}
+}
+
+// newPublishEvent describes the bundles of a successful Write
+func (s3w *S3Writer) newPublishEvent(date time.Time, bundles []bundle, updates []pointerUpdate) publishEvent {
+	e := publishEvent{
+		Destination:     s3w.destination,
+		Backend:         s3w.backend,
+		Bucket:          s3w.bucket,
+		PublicationDate: date,
+		Published:       time.Now().UTC(),
+		Bundles:         []publishedBundle{},
+	}
+	for i, b := range bundles {
+		kind := fileKind(b.fileName)
+		e.JobID = b.manifest.JobID
+		packages := b.manifest.Archives
+		if packages == nil {
+			packages = []manifestArchive{}
+		}
+		e.Bundles = append(e.Bundles, publishedBundle{
+			Kind:     kind,
+			Key:      updates[i].key,
+			Manifest: s3w.layout.dataKey(kind, manifestName(b.fileName), b.manifest.JobID, date),
+			Pointer:  updates[i].name,
+			Packages: packages,
+		})
+	}
+	return e
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3Writer_Write_EmitsPublishEvent(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("weekly.zip")()
+
+	var events []publishEvent
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var e publishEvent
+		as.NoError(json.NewDecoder(req.Body).Decode(&e))
+		events = append(events, e)
+	}))
+	defer server.Close()
+
+	ee, err := newEventEmitter(eventsConfig{httpURL: server.URL})
+	as.NoError(err)
+	layout, err := newKeyLayout("factset/{kind}/{jobId}/{file}", "factset/{kind}", "")
+	as.NoError(err)
+	wr := S3Writer{s3Client: newInMemoryS3ClientMock(map[string][]byte{}), layout: layout, events: ee, destination: "backup", backend: s3Backend, bucket: "factset"}
+	packages := []manifestArchive{{Name: "edm_premium_full_1532.zip", MajorVersion: 1, MinorVersion: 1532}}
+	published := time.Date(2017, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	err = wr.Write(context.Background(), dataFolder, []bundle{{fileName: "weekly.zip", manifest: manifest{JobID: "job1", PublicationDate: published, Archives: packages}}})
+	as.NoError(err)
+	as.Len(events, 1)
+	as.Equal("job1", events[0].JobID)
+	as.Equal("backup", events[0].Destination)
+	as.Equal("factset", events[0].Bucket)
+	as.Equal(published, events[0].PublicationDate)
+	as.Equal([]publishedBundle{{
+		Kind:     weekly,
+		Key:      "factset/weekly/job1/weekly.zip",
+		Manifest: "factset/weekly/job1/weekly.manifest.json",
+		Pointer:  "factset/weekly",
+		Packages: packages,
+	}}, events[0].Bundles)
+}
+
+func TestS3Writer_Write_IgnoresFailedEvents(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip")()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ee, err := newEventEmitter(eventsConfig{httpURL: server.URL})
+	as.NoError(err)
+	objects := map[string][]byte{}
+	wr := S3Writer{s3Client: newInMemoryS3ClientMock(objects), events: ee}
+
+	as.NoError(wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}}))
+	as.Contains(objects, "daily")
+}
+
+func TestNewEventEmitterValidatesSettings(t *testing.T) {
+	as := assert.New(t)
+
+	_, err := newEventEmitter(eventsConfig{kafkaBrokers: "kafka:9092"})
+	as.Error(err)
+	_, err = newEventEmitter(eventsConfig{snsTopicARN: "factset-published"})
+	as.Error(err)
+	_, err = newEventEmitter(eventsConfig{sqsQueueURL: "http://localhost:9324/queue/factset", aws: s3Config{accKey: "key", secretKey: "secret"}})
+	as.Error(err)
+
+	ee, err := newEventEmitter(eventsConfig{kafkaBrokers: "kafka1:9092, kafka2:9092", kafkaTopic: "factset-published"})
+	as.NoError(err)
+	as.Len(ee.publishers, 1)
+}
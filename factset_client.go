@@ -1,24 +1,30 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path"
 	"strconv"
+	"time"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
 type FactsetClient interface {
-	Init() error
+	Init(ctx context.Context) error
 	Close()
-	ReadDir(dir string) ([]os.FileInfo, error)
-	Download(path string, dest string) error
+	ReadDir(ctx context.Context, dir string) ([]os.FileInfo, error)
+	Download(ctx context.Context, path string, dest string) error
 }
 
+// sshTimeout bounds connecting to an sftp server, including the ssh and sftp handshakes
+const sshTimeout = 30 * time.Second
+
 type SFTPClient struct {
 	config sftpConfig
 	ssh    *ssh.Client
@@ -41,46 +47,86 @@ func (s *SFTPClient) getSSHConfig(username string, key string) (*ssh.ClientConfi
 	return c, nil
 }
 
-func (s *SFTPClient) initSSHClient(config sftpConfig) error {
+// Init connects to the server. The ssh and sftp handshakes take no context, so they are bounded by a deadline
+// on the connection, the deadline of ctx or sshTimeout, whichever comes first, and cancelling ctx closes the connection.
+func (s *SFTPClient) Init(ctx context.Context) error {
 	c, err := s.getSSHConfig(s.config.username, s.config.key)
 	if err != nil {
 		return err
 	}
-
-	tcpConn, err := ssh.Dial("tcp", config.address+":"+strconv.Itoa(config.port), c)
+	addr := s.config.address + ":" + strconv.Itoa(s.config.port)
+	dialer := net.Dialer{Timeout: sshTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return err
 	}
-
-	s.ssh = tcpConn
-	return nil
-}
-
-func (s *SFTPClient) Init() error {
-	err := s.initSSHClient(s.config)
+	deadline := time.Now().Add(sshTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	defer closeOnCancel(ctx, func() { conn.Close() })()
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, c)
 	if err != nil {
+		conn.Close()
 		return err
 	}
+	s.ssh = ssh.NewClient(sshConn, chans, reqs)
 	client, err := sftp.NewClient(s.ssh)
 	if err != nil {
 		return err
 	}
 	s.sftp = client
-	return nil
+	return conn.SetDeadline(time.Time{})
 }
 
-func (s *SFTPClient) ReadDir(dir string) ([]os.FileInfo, error) {
-	return s.sftp.ReadDir(dir)
+// ReadDir lists a directory of the server; cancelling ctx closes the connection, see Download
+func (s *SFTPClient) ReadDir(ctx context.Context, dir string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer closeOnCancel(ctx, s.Close)()
+	files, err := s.sftp.ReadDir(dir)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return files, err
+}
+
+// closeOnCancel calls closeConn if ctx is cancelled before the returned func is called, as a hung
+// ssh or sftp request cannot be interrupted otherwise
+func closeOnCancel(ctx context.Context, closeConn func()) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			closeConn()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
 }
 
-func (s SFTPClient) Download(path string, dest string) error {
+// Download copies a file of the Factset server to dest. A hung read cannot be interrupted, so cancelling ctx
+// closes the connection, and the client cannot be used any more.
+func (s SFTPClient) Download(ctx context.Context, path string, dest string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer closeOnCancel(ctx, s.Close)()
 	file, err := s.sftp.Open(path)
-	file.Name()
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	return s.save(file, dest)
+
+	err = s.save(file, dest)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
 
 func (s *SFTPClient) save(file *sftp.File, dest string) error {
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSFTPClientInitStopsAtDeadline(t *testing.T) {
+	as := assert.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	as.NoError(err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	// a server that accepts connections but never answers the ssh handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	as.NoError(err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	c := &SFTPClient{config: sftpConfig{address: "127.0.0.1", port: port, username: "factset", key: string(pemKey)}}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	as.Error(c.Init(ctx))
+	as.True(time.Since(start) < sshTimeout)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// importHistory remembers when each kind of bundle was last published and the last error of each kind of import
+type importHistory struct {
+	sync.Mutex
+	published map[string]time.Time
+	lastError map[string]string
+}
+
+func newImportHistory() *importHistory {
+	return &importHistory{published: map[string]time.Time{}, lastError: map[string]string{}}
+}
+
+func (h *importHistory) recordPublished(kind string, at time.Time) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	if at.After(h.published[kind]) {
+		h.published[kind] = at
+	}
+}
+
+func (h *importHistory) recordFailure(kind string, err error) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.lastError[kind] = err.Error()
+}
+
+func (h *importHistory) last(kind string) (time.Time, string) {
+	if h == nil {
+		return time.Time{}, ""
+	}
+	h.Lock()
+	defer h.Unlock()
+	return h.published[kind], h.lastError[kind]
+}
+
+func jobKind(job importJob) string {
+	if job.weekly {
+		return weekly
+	}
+	return daily
+}
+
+// lastPublished returns when a kind of bundle was last published; before the first import since start up,
+// it is taken from the pointer of the primary destination, in the layout of the first resource
+func (s service) lastPublished(ctx context.Context, kind string) (time.Time, error) {
+	published, _ := s.history.last(kind)
+	if !published.IsZero() {
+		return published, nil
+	}
+	d := s.writeDestinations()[0]
+	var rl resourceLayout
+	if len(s.files) > 0 {
+		rl = s.files[0].layout
+	}
+	layout, err := rl.keys(d.config)
+	if err != nil {
+		return published, err
+	}
+	client, err := NewStorageClient(d.config)
+	if err != nil {
+		return published, err
+	}
+	info, err := client.StatObject(ctx, layout.pointerKey(kind))
+	if err == errObjectNotFound {
+		return published, nil
+	}
+	if err != nil {
+		return published, err
+	}
+	s.history.recordPublished(kind, info.lastModified)
+	return info.lastModified, nil
+}
+
+// checkFreshness fails when the last successful import of a kind of bundle is older than its threshold
+func (s service) checkFreshness(ctx context.Context, kind string, now time.Time) (string, error) {
+	maxAge := s.maxImportAge[kind]
+	if maxAge <= 0 {
+		return fmt.Sprintf("No threshold set for %s imports", kind), nil
+	}
+	published, err := s.lastPublished(ctx, kind)
+	if err != nil {
+		return "", fmt.Errorf("Could not find when the last %s import was published: %v", kind, err)
+	}
+	_, lastError := s.history.last(kind)
+	if lastError == "" {
+		lastError = "none"
+	}
+	if published.IsZero() {
+		return "", fmt.Errorf("No successful %s import found, last error: %s", kind, lastError)
+	}
+	age := now.Sub(published).Truncate(time.Second)
+	if age > maxAge {
+		return "", fmt.Errorf("Last successful %s import was %s ago, more than %s, last error: %s", kind, age, maxAge, lastError)
+	}
+	return fmt.Sprintf("Last successful %s import was %s ago", kind, age), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFreshness(t *testing.T) {
+	as := assert.New(t)
+
+	now := time.Date(2017, 4, 3, 12, 0, 0, 0, time.UTC)
+	s := service{history: newImportHistory(), maxImportAge: map[string]time.Duration{daily: 26 * time.Hour}}
+
+	_, err := s.checkFreshness(context.Background(), weekly, now)
+	as.NoError(err)
+
+	s.history.recordPublished(daily, now.Add(-2*time.Hour))
+	msg, err := s.checkFreshness(context.Background(), daily, now)
+	as.NoError(err)
+	as.Equal("Last successful daily import was 2h0m0s ago", msg)
+
+	s.history = newImportHistory()
+	s.history.recordPublished(daily, now.Add(-30*time.Hour))
+	s.history.recordFailure(daily, errors.New("Did not find any matching files"))
+	_, err = s.checkFreshness(context.Background(), daily, now)
+	as.Error(err)
+	as.True(strings.Contains(err.Error(), "30h0m0s ago"))
+	as.True(strings.Contains(err.Error(), "Did not find any matching files"))
+}
+
+func TestCheckFreshnessReadsThePointerAfterStartUp(t *testing.T) {
+	as := assert.New(t)
+
+	root, err := ioutil.TempDir("", "freshness")
+	as.NoError(err)
+	defer os.RemoveAll(root)
+
+	s := service{
+		wrConfig:     s3Config{backend: fsBackend, bucket: root},
+		history:      newImportHistory(),
+		maxImportAge: map[string]time.Duration{daily: time.Hour, weekly: time.Hour},
+	}
+	_, err = s.checkFreshness(context.Background(), daily, time.Now())
+	as.Error(err)
+
+	as.NoError(ioutil.WriteFile(filepath.Join(root, "daily"), []byte("2017-04-03/daily.zip"), 0644))
+	_, err = s.checkFreshness(context.Background(), daily, time.Now())
+	as.NoError(err)
+	_, err = s.checkFreshness(context.Background(), daily, time.Now().Add(2*time.Hour))
+	as.Error(err)
+}
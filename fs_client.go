@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FSClient stores the objects as files under a local root directory, e.g. a volume shared with an on-prem cluster.
+// Storage classes, tags and metadata do not apply to files and are ignored.
+type FSClient struct {
+	root string
+}
+
+func NewFSClient(config s3Config) (S3Client, error) {
+	if err := validateFSConfig(config); err != nil {
+		return nil, err
+	}
+	return &FSClient{root: config.bucket}, nil
+}
+
+func validateFSConfig(config s3Config) error {
+	if config.bucket == "" {
+		return errors.New("A root directory is required for the fs storage backend")
+	}
+	return nil
+}
+
+func (fs *FSClient) path(objectName string) (string, error) {
+	p := filepath.Join(fs.root, filepath.FromSlash(objectName))
+	if !strings.HasPrefix(p, strings.TrimSuffix(filepath.Clean(fs.root), string(filepath.Separator))+string(filepath.Separator)) {
+		return "", errors.New("Object name [" + objectName + "] is outside of the root directory")
+	}
+	return p, nil
+}
+
+func (fs *FSClient) PutObject(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	return fs.write(objectName, withContext(ctx, withProgress(src, opts.progress)))
+}
+
+func (fs *FSClient) PutData(ctx context.Context, objectName string, data []byte, opts objectOptions) error {
+	_, err := fs.write(objectName, withContext(ctx, strings.NewReader(string(data))))
+	return err
+}
+
+// write copies to a temporary file first, so readers never see a partially written object,
+// and reads the stored file back to check it holds the bytes written
+func (fs *FSClient) write(objectName string, r io.Reader) (int64, error) {
+	p, err := fs.path(objectName)
+	if err != nil {
+		return 0, err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p))
+	if err != nil {
+		return 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return n, err
+	}
+	err = os.Rename(tmp.Name(), p)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return n, err
+	}
+	stored, err := os.Open(p)
+	if err != nil {
+		return n, err
+	}
+	defer stored.Close()
+	return n, checkStored(objectName, stored, h.Sum(nil))
+}
+
+func (fs *FSClient) GetData(ctx context.Context, objectName string) ([]byte, error) {
+	p, err := fs.path(objectName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, errObjectNotFound
+	}
+	return data, err
+}
+
+// StatObject reports files as verified on upload, as write has read every file back; the ETag is made of
+// the modification time and size, files carry no checksum
+func (fs *FSClient) StatObject(ctx context.Context, objectName string) (objectInfo, error) {
+	p, err := fs.path(objectName)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	stat, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return objectInfo{}, errObjectNotFound
+	}
+	if err != nil {
+		return objectInfo{}, err
+	}
+	return objectInfo{key: objectName, size: stat.Size(), etag: fileETag(stat), verifiedOnUpload: true, lastModified: stat.ModTime()}, nil
+}
+
+func (fs *FSClient) RemoveObject(ctx context.Context, objectName string) error {
+	p, err := fs.path(objectName)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ListObjects lists the files under the root directory whose names start with the prefix, without their ETags
+func (fs *FSClient) ListObjects(ctx context.Context, prefix string) ([]objectInfo, error) {
+	var objects []objectInfo
+	err := filepath.Walk(fs.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(fs.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, objectInfo{key: key, size: info.Size(), lastModified: info.ModTime()})
+		}
+		return nil
+	})
+	return objects, err
+}
+
+func (fs *FSClient) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	info, err := os.Stat(fs.root)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSClientRoundTrip(t *testing.T) {
+	as := assert.New(t)
+
+	root, err := ioutil.TempDir("", "fs-client")
+	as.NoError(err)
+	defer os.RemoveAll(root)
+	fs, err := NewFSClient(s3Config{bucket: root})
+	as.NoError(err)
+
+	exists, err := fs.BucketExists(context.Background(), root)
+	as.NoError(err)
+	as.True(exists)
+
+	_, err = fs.GetData(context.Background(), "daily")
+	as.Equal(errObjectNotFound, err)
+
+	err = fs.PutData(context.Background(), "2017-01-01/daily.manifest.json", []byte("{}"), objectOptions{})
+	as.NoError(err)
+	n, err := fs.PutObject(context.Background(), "2017-01-01/daily.zip", filepath.Join(dataFolder, "edm_security_entity_map_test.txt"), objectOptions{})
+	as.NoError(err)
+
+	info, err := fs.StatObject(context.Background(), "2017-01-01/daily.zip")
+	as.NoError(err)
+	as.Equal(n, info.size)
+	as.NotEmpty(info.etag)
+	as.True(info.verifiedOnUpload)
+
+	objects, err := fs.ListObjects(context.Background(), "2017-01-01/")
+	as.NoError(err)
+	as.Len(objects, 2)
+
+	data, err := fs.GetData(context.Background(), "2017-01-01/daily.manifest.json")
+	as.NoError(err)
+	as.Equal("{}", string(data))
+
+	as.NoError(fs.RemoveObject(context.Background(), "2017-01-01/daily.zip"))
+	as.NoError(fs.RemoveObject(context.Background(), "2017-01-01/daily.zip"))
+	_, err = fs.StatObject(context.Background(), "2017-01-01/daily.zip")
+	as.Equal(errObjectNotFound, err)
+}
+
+func TestFSClientPutObjectStopsWhenCancelled(t *testing.T) {
+	as := assert.New(t)
+	root, err := ioutil.TempDir("", "factset-fs")
+	as.NoError(err)
+	defer os.RemoveAll(root)
+
+	fs := &FSClient{root: root}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = fs.PutObject(ctx, "2017-01-01/daily.zip", filepath.Join(dataFolder, "edm_security_entity_map_test.txt"), objectOptions{})
+	as.Equal(context.Canceled, err)
+	_, err = fs.StatObject(context.Background(), "2017-01-01/daily.zip")
+	as.Equal(errObjectNotFound, err)
+}
+
+func TestFSClientRejectsKeysOutsideRoot(t *testing.T) {
+	as := assert.New(t)
+
+	fs := &FSClient{root: "/tmp/factset"}
+	err := fs.PutData(context.Background(), "../etc/daily", []byte("daily.zip"), objectOptions{})
+	as.Error(err)
+}
+
+func TestNewStorageClientUnknownBackend(t *testing.T) {
+	as := assert.New(t)
+
+	_, err := NewStorageClient(s3Config{backend: "ftp"})
+	as.Error(err)
+
+	_, err = NewStorageClient(s3Config{backend: fsBackend})
+	as.Error(err)
+
+	_, err = NewStorageClient(s3Config{backend: azureBackend, bucket: "factset"})
+	as.Error(err)
+}
+
+func TestValidateStorageConfig(t *testing.T) {
+	as := assert.New(t)
+
+	as.Error(validateStorageConfig(s3Config{backend: "ftp"}))
+	as.Error(validateStorageConfig(s3Config{backend: sftpBackend, bucket: "/factset"}))
+	as.Error(validateStorageConfig(s3Config{sse: sseKMS}))
+	as.NoError(validateStorageConfig(s3Config{backend: gcsBackend, sse: sseKMS}))
+	as.NoError(validateStorageConfig(s3Config{backend: sftpBackend, bucket: "/factset", sftpPush: sftpConfig{address: "sftp.example.com"}}))
+}
+
+func TestCheckStoredComparesWithTheBytesWritten(t *testing.T) {
+	as := assert.New(t)
+
+	written := sha256.Sum256([]byte("2017-01-01/daily.zip"))
+	as.NoError(checkStored("daily", strings.NewReader("2017-01-01/daily.zip"), written[:]))
+	as.Error(checkStored("daily", strings.NewReader("2017-01-01/daily.zi"), written[:]))
+}
@@ -1,57 +1,248 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"time"
 
-	"github.com/Financial-Times/go-fthealth/v1a"
+	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/service-status-go/gtg"
 	log "github.com/Sirupsen/logrus"
 )
 
-func (h *httpHandler) factsetHealthcheck() v1a.Check {
-	return v1a.Check{
+// IDs of the healthchecks; GTG depends on the connectivity checks
+const (
+	factsetCheck         = "factset-connectivity"
+	s3Check              = "s3-connectivity"
+	dailyFreshnessCheck  = "daily-import-freshness"
+	weeklyFreshnessCheck = "weekly-import-freshness"
+	pointersCheck        = "index-files"
+	resourcesCheck       = "factset-resources"
+)
+
+// checkTimeout bounds every run of a check, and the answer of the health endpoint when checks are not cached
+const checkTimeout = 10 * time.Second
+
+var healthcheckIDs = []string{factsetCheck, s3Check, dailyFreshnessCheck, weeklyFreshnessCheck, pointersCheck, resourcesCheck}
+
+// healthSettings are the settings of the health endpoint that differ between environments
+type healthSettings struct {
+	systemCode string
+	runbook    string
+	runbooks   map[string]string
+	severities map[string]uint8
+}
+
+func (h *httpHandler) healthcheck() fthealth.TimedHealthCheck {
+	return fthealth.TimedHealthCheck{
+		HealthCheck: fthealth.HealthCheck{
+			SystemCode:  h.health.systemCode,
+			Name:        "Factset Reader Healthchecks",
+			Description: "Checks for accessing Factset server and Amazon S3 bucket",
+			Checks:      h.healthchecks(),
+		},
+		Timeout: checkTimeout,
+	}
+}
+
+func (h *httpHandler) healthchecks() []fthealth.Check {
+	checks := []fthealth.Check{h.factsetHealthcheck(), h.amazonS3Healthcheck(), h.freshnessHealthcheck(daily), h.freshnessHealthcheck(weekly), h.pointersHealthcheck()}
+	if h.checkResources {
+		checks = append(checks, h.resourcesHealthcheck())
+	}
+	for i := range checks {
+		checks[i] = h.withSettings(checks[i])
+	}
+	return checks
+}
+
+// withSettings sets the runbook and, if one is configured, the severity of a check
+func (h *httpHandler) withSettings(c fthealth.Check) fthealth.Check {
+	c.PanicGuide = h.health.runbook
+	if runbook, found := h.health.runbooks[c.ID]; found {
+		c.PanicGuide = runbook
+	}
+	if severity, found := h.health.severities[c.ID]; found {
+		c.Severity = severity
+	}
+	return c
+}
+
+// getSeverities parses a comma separated list of check IDs and severities (1 to 3)
+func getSeverities(list string) (map[string]uint8, error) {
+	values, err := getKeyValues(list, "=")
+	if err != nil {
+		return nil, err
+	}
+	severities := map[string]uint8{}
+	for id, value := range values {
+		if err := validateHealthcheckID(id); err != nil {
+			return nil, err
+		}
+		severity, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || severity < 1 || severity > 3 {
+			return nil, fmt.Errorf("Invalid severity [%s] of healthcheck [%s], expected 1, 2 or 3", value, id)
+		}
+		severities[id] = uint8(severity)
+	}
+	return severities, nil
+}
+
+// getRunbooks parses a comma separated list of check IDs and runbook links
+func getRunbooks(list string) (map[string]string, error) {
+	runbooks, err := getKeyValues(list, "=")
+	if err != nil {
+		return nil, err
+	}
+	for id := range runbooks {
+		if err := validateHealthcheckID(id); err != nil {
+			return nil, err
+		}
+	}
+	return runbooks, nil
+}
+
+func validateHealthcheckID(id string) error {
+	for _, known := range healthcheckIDs {
+		if id == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown healthcheck [%s], expected one of %v", id, healthcheckIDs)
+}
+
+func freshnessCheck(kind string) string {
+	if kind == weekly {
+		return weeklyFreshnessCheck
+	}
+	return dailyFreshnessCheck
+}
+
+func (h *httpHandler) factsetHealthcheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               factsetCheck,
 		BusinessImpact:   "Unable to download the latest dataset from Factset",
 		Name:             "Check connectivity to Factset",
-		PanicGuide:       "TODO",
 		Severity:         1,
 		TechnicalSummary: "Cannot connect to Factset to be able to supply financial instruments",
-		Checker:          h.checkConnectivityToFactset,
+		Checker:          h.checker(factsetCheck),
 	}
 }
 
-func (h *httpHandler) amazonS3Healthcheck() v1a.Check {
-	return v1a.Check{
+func (h *httpHandler) amazonS3Healthcheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               s3Check,
 		BusinessImpact:   "Unable to write the latest dataset to S3",
 		Name:             "Check connectivity to Amazon S3",
-		PanicGuide:       "TODO",
 		Severity:         1,
 		TechnicalSummary: "Cannot connect to Amazon S3 bucket to write the latest factset dataset",
-		Checker:          h.checkConnectivityToS3,
+		Checker:          h.checker(s3Check),
+	}
+}
+
+func (h *httpHandler) freshnessHealthcheck(kind string) fthealth.Check {
+	return fthealth.Check{
+		ID:               freshnessCheck(kind),
+		BusinessImpact:   fmt.Sprintf("Consumers read outdated %s Factset data", kind),
+		Name:             fmt.Sprintf("Check the last successful %s import", kind),
+		Severity:         2,
+		TechnicalSummary: fmt.Sprintf("The last successful %s import is older than the configured threshold, check the jobs endpoint for the errors of the recent imports", kind),
+		Checker:          h.checker(freshnessCheck(kind)),
+	}
+}
+
+func (h *httpHandler) pointersHealthcheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               pointersCheck,
+		BusinessImpact:   "Consumers cannot load the latest Factset data",
+		Name:             "Check the published index files",
+		Severity:         1,
+		TechnicalSummary: "An index file (daily or weekly) refers to a zip that is missing, empty or does not match its manifest",
+		Checker:          h.checker(pointersCheck),
+	}
+}
+
+func (h *httpHandler) resourcesHealthcheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               resourcesCheck,
+		BusinessImpact:   "Some Factset datasets can no longer be imported",
+		Name:             "Check the Factset resources are available",
+		Severity:         2,
+		TechnicalSummary: "The directory of a Factset resource cannot be listed or holds no package of the resource, the feed may have been removed from the Factset entitlements",
+		Checker:          h.checker(resourcesCheck),
 	}
 }
 
-func (h *httpHandler) checkConnectivityToFactset() (string, error) {
-	err := h.s.checkConnectivityToFactset()
+// checks returns the checks of the health and GTG endpoints by ID
+func (h *httpHandler) checks() map[string]func() (string, error) {
+	checks := map[string]func() (string, error){
+		factsetCheck:         withCheckTimeout(h.checkConnectivityToFactset),
+		s3Check:              withCheckTimeout(h.checkConnectivityToS3),
+		dailyFreshnessCheck:  withCheckTimeout(h.checkFreshness(daily)),
+		weeklyFreshnessCheck: withCheckTimeout(h.checkFreshness(weekly)),
+		pointersCheck:        withCheckTimeout(h.checkPublishedPointers),
+	}
+	if h.checkResources {
+		checks[resourcesCheck] = withCheckTimeout(h.checkResourcesAvailable)
+	}
+	return checks
+}
+
+// withCheckTimeout cancels a run of a check after checkTimeout, so a hung connection does not keep it running
+func withCheckTimeout(check func(ctx context.Context) (string, error)) func() (string, error) {
+	return func() (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		defer cancel()
+		return check(ctx)
+	}
+}
+
+func (h *httpHandler) checkFreshness(kind string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		msg, err := h.s.checkFreshness(ctx, kind, time.Now())
+		recordHealthcheck(freshnessCheck(kind), err)
+		return msg, err
+	}
+}
+
+func (h *httpHandler) checkPublishedPointers(ctx context.Context) (string, error) {
+	msg, err := h.s.checkPublishedPointers(ctx)
+	recordHealthcheck(pointersCheck, err)
+	return msg, err
+}
+
+func (h *httpHandler) checkResourcesAvailable(ctx context.Context) (string, error) {
+	msg, err := h.s.checkResourcesAvailable(ctx)
+	recordHealthcheck(resourcesCheck, err)
+	return msg, err
+}
+
+func (h *httpHandler) checkConnectivityToFactset(ctx context.Context) (string, error) {
+	err := h.s.checkConnectivityToFactset(ctx)
+	recordHealthcheck(factsetCheck, err)
 	if err != nil {
 		return fmt.Sprintf("Healthcheck: Unable to connect to Factset server: %v", err.Error()), err
 	}
 	return "", nil
 }
 
-func (h *httpHandler) checkConnectivityToS3() (string, error) {
-	err := h.s.checkConnectivityToAmazonS3()
+func (h *httpHandler) checkConnectivityToS3(ctx context.Context) (string, error) {
+	err := h.s.checkConnectivityToAmazonS3(ctx)
+	recordHealthcheck(s3Check, err)
 	if err != nil {
 		return fmt.Sprintf("Healthcheck: Unable to connect to Amazon S3: %v", err.Error()), err
 	}
 	return "", nil
 }
 
+// goodToGo answers from the cached connectivity checks, if checks are cached
 func (h *httpHandler) goodToGo() gtg.Status {
-	if msg, err := h.checkConnectivityToFactset(); err != nil {
+	if msg, err := h.checker(factsetCheck)(); err != nil {
 		log.Error(err)
 		return gtg.Status{GoodToGo: false, Message: msg}
 	}
-	if msg, err := h.checkConnectivityToS3(); err != nil {
+	if msg, err := h.checker(s3Check)(); err != nil {
 		log.Error(err)
 		return gtg.Status{GoodToGo: false, Message: msg}
 	}
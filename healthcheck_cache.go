@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
+	log "github.com/Sirupsen/logrus"
+)
+
+// checkResult is the outcome of the latest run of a healthcheck
+type checkResult struct {
+	msg      string
+	err      error
+	finished time.Time
+}
+
+// healthcheckCache runs the healthchecks on a ticker and keeps their latest results, so the health and
+// GTG endpoints answer at once instead of waiting for Factset and the destinations
+type healthcheckCache struct {
+	sync.Mutex
+	interval time.Duration
+	maxAge   time.Duration
+	checks   map[string]func() (string, error)
+	results  map[string]checkResult
+	running  map[string]bool
+	stopped  chan struct{}
+}
+
+func newHealthcheckCache(interval time.Duration, maxAge time.Duration) *healthcheckCache {
+	return &healthcheckCache{
+		interval: interval,
+		maxAge:   maxAge,
+		checks:   map[string]func() (string, error){},
+		results:  map[string]checkResult{},
+		running:  map[string]bool{},
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (c *healthcheckCache) register(name string, check func() (string, error)) {
+	c.Lock()
+	defer c.Unlock()
+	c.checks[name] = check
+}
+
+// start runs all checks now and then on every tick, until the cache is stopped
+func (c *healthcheckCache) start() {
+	c.runAll()
+	ticker := time.NewTicker(c.interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.runAll()
+			case <-c.stopped:
+				return
+			}
+		}
+	}()
+}
+
+// stop ends the runs on every tick; the latest results are kept
+func (c *healthcheckCache) stop() {
+	close(c.stopped)
+}
+
+// runAll starts a run of every check that is not still running from a previous tick
+func (c *healthcheckCache) runAll() {
+	c.Lock()
+	defer c.Unlock()
+	for name, check := range c.checks {
+		if c.running[name] {
+			log.WithField("check", name).Warn("Healthcheck is still running, skipping this run")
+			continue
+		}
+		c.running[name] = true
+		go c.run(name, check)
+	}
+}
+
+func (c *healthcheckCache) run(name string, check func() (string, error)) {
+	msg, err := check()
+	c.Lock()
+	defer c.Unlock()
+	c.running[name] = false
+	c.results[name] = checkResult{msg: msg, err: err, finished: time.Now()}
+}
+
+// result returns the latest result of a check and its error; a result older than maxAge is a failure, since
+// the check hangs or does not run any more
+func (c *healthcheckCache) result(name string, now time.Time) (checkResult, error) {
+	c.Lock()
+	defer c.Unlock()
+	r, found := c.results[name]
+	if !found {
+		return r, fmt.Errorf("Healthcheck %s has not finished yet", name)
+	}
+	if age := now.Sub(r.finished); age > c.maxAge {
+		return r, fmt.Errorf("Healthcheck %s last finished %s ago, more than %s", name, age.Truncate(time.Second), c.maxAge)
+	}
+	return r, r.err
+}
+
+// cacheChecks registers all checks with the cache, once before the cache is started
+func (h *httpHandler) cacheChecks(cache *healthcheckCache) {
+	for name, check := range h.checks() {
+		cache.register(name, check)
+	}
+	h.cache = cache
+}
+
+// checker returns a checker answering from the cache, or the check itself if checks are not cached
+func (h *httpHandler) checker(name string) func() (string, error) {
+	if h.cache == nil {
+		return h.checks()[name]
+	}
+	return func() (string, error) {
+		r, err := h.cache.result(name, time.Now())
+		return r.msg, err
+	}
+}
+
+// healthHandler serves the healthchecks; cached results are reported as last updated when their check finished
+func (h *httpHandler) healthHandler() http.HandlerFunc {
+	if h.cache == nil {
+		return fthealth.Handler(h.healthcheck())
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var lock sync.Mutex
+		finished := map[string]time.Time{}
+		hc := h.healthcheck()
+		for i := range hc.Checks {
+			id := hc.Checks[i].ID
+			hc.Checks[i].Checker = func() (string, error) {
+				r, err := h.cache.result(id, time.Now())
+				lock.Lock()
+				defer lock.Unlock()
+				finished[id] = r.finished
+				return r.msg, err
+			}
+		}
+		health := fthealth.RunCheck(hc)
+		lock.Lock()
+		for i, c := range health.Checks {
+			if t, found := finished[c.ID]; found && !t.IsZero() {
+				health.Checks[i].LastUpdated = t
+			}
+		}
+		lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(health); err != nil {
+			log.Errorf("Could not write the healthcheck response: %v", err)
+		}
+	}
+}
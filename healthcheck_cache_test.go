@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthcheckCacheReportsLatestResult(t *testing.T) {
+	as := assert.New(t)
+
+	c := newHealthcheckCache(time.Minute, 3*time.Minute)
+	_, err := c.result(factsetCheck, time.Now())
+	as.Error(err)
+
+	c.run(factsetCheck, func() (string, error) { return "Unable to connect", errors.New("timeout") })
+	r, err := c.result(factsetCheck, time.Now())
+	as.Equal("Unable to connect", r.msg)
+	as.EqualError(err, "timeout")
+
+	c.run(factsetCheck, func() (string, error) { return "", nil })
+	_, err = c.result(factsetCheck, time.Now())
+	as.NoError(err)
+
+	_, err = c.result(factsetCheck, time.Now().Add(4*time.Minute))
+	as.Error(err)
+}
+
+func TestHealthcheckCacheSkipsChecksStillRunning(t *testing.T) {
+	as := assert.New(t)
+
+	var calls int32
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	c := newHealthcheckCache(time.Minute, 3*time.Minute)
+	c.register(factsetCheck, func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		started <- struct{}{}
+		<-release
+		return "", nil
+	})
+	c.runAll()
+	<-started
+	c.runAll()
+	close(release)
+
+	as.Equal(int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGoodToGoAnswersFromCache(t *testing.T) {
+	as := assert.New(t)
+
+	h := &httpHandler{}
+	h.cacheChecks(newHealthcheckCache(time.Minute, 3*time.Minute))
+	as.Len(h.cache.checks, 5)
+	as.False(h.goodToGo().GoodToGo)
+	as.Len(h.cache.checks, 5)
+
+	h.cache.run(factsetCheck, func() (string, error) { return "", nil })
+	h.cache.run(s3Check, func() (string, error) { return "", nil })
+	as.True(h.goodToGo().GoodToGo)
+}
+
+func TestHealthReportsWhenCachedChecksFinished(t *testing.T) {
+	as := assert.New(t)
+
+	h := &httpHandler{}
+	h.cacheChecks(newHealthcheckCache(time.Minute, 3*time.Minute))
+	finished := time.Now().Add(-2 * time.Minute)
+	h.cache.results[factsetCheck] = checkResult{finished: finished}
+
+	rec := httptest.NewRecorder()
+	h.healthHandler()(rec, httptest.NewRequest("GET", "/__health", nil))
+	var health fthealth.HealthResult
+	as.NoError(json.Unmarshal(rec.Body.Bytes(), &health))
+	as.Len(health.Checks, 5)
+	for _, c := range health.Checks {
+		if c.ID == factsetCheck {
+			as.True(c.Ok)
+			as.True(finished.Equal(c.LastUpdated))
+		} else {
+			as.False(c.Ok)
+		}
+	}
+}
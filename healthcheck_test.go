@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthchecksApplySettings(t *testing.T) {
+	as := assert.New(t)
+
+	h := &httpHandler{health: healthSettings{
+		runbook:    "https://runbooks.example.com/factset-reader",
+		runbooks:   map[string]string{pointersCheck: "https://runbooks.example.com/factset-reader#index-files"},
+		severities: map[string]uint8{dailyFreshnessCheck: 3},
+	}}
+	checks := h.healthchecks()
+	as.Len(checks, 5)
+
+	byID := map[string]int{}
+	for i, c := range checks {
+		byID[c.ID] = i
+		as.NotEmpty(c.PanicGuide)
+	}
+	as.Equal("https://runbooks.example.com/factset-reader", checks[byID[factsetCheck]].PanicGuide)
+	as.Equal(uint8(1), checks[byID[factsetCheck]].Severity)
+	as.Equal("https://runbooks.example.com/factset-reader#index-files", checks[byID[pointersCheck]].PanicGuide)
+	as.Equal(uint8(3), checks[byID[dailyFreshnessCheck]].Severity)
+	as.Equal(uint8(2), checks[byID[weeklyFreshnessCheck]].Severity)
+
+	h.checkResources = true
+	as.Len(h.healthchecks(), 6)
+}
+
+func TestGetSeverities(t *testing.T) {
+	as := assert.New(t)
+
+	severities, err := getSeverities("daily-import-freshness=2,factset-connectivity=1")
+	as.NoError(err)
+	as.Equal(map[string]uint8{dailyFreshnessCheck: 2, factsetCheck: 1}, severities)
+
+	_, err = getSeverities("daily-import-freshness=4")
+	as.Error(err)
+	_, err = getSeverities("monthly-import-freshness=2")
+	as.Error(err)
+
+	_, err = getRunbooks("s3=https://runbooks.example.com")
+	as.Error(err)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobAborted   = "aborted"
+)
+
+// abortTimeout is how long a shutdown waits for aborted jobs to clean up
+const abortTimeout = 10 * time.Second
+
+var errShuttingDown = errors.New("The service is shutting down")
+var errJobAborted = errors.New("Import job was aborted")
+var errJobNotFound = errors.New("Job not found")
+var errJobNotRunning = errors.New("Job is not running")
+
+// phases of an import job
+const (
+	downloadPhase = "download"
+	zipPhase      = "zip"
+	uploadPhase   = "upload"
+)
+
+const defaultJobHistory = 20
+
+type importJob struct {
+	id        string
+	weekly    bool
+	started   time.Time
+	published time.Time
+}
+
+func newImportJob(weekly bool) (importJob, error) {
+	started := time.Now().UTC()
+	id, err := newJobID(started)
+	if err != nil {
+		return importJob{}, err
+	}
+	return importJob{id: id, weekly: weekly, started: started}, nil
+}
+
+// publicationDate returns the date under which all files of a run are published: the release time
+// of the most recent Factset package of the run, or the job start time if none is known
+func publicationDate(colls []zipCollection, started time.Time) time.Time {
+	var published time.Time
+	for _, coll := range colls {
+		if coll.published.After(published) {
+			published = coll.published
+		}
+	}
+	if published.IsZero() {
+		return started.UTC()
+	}
+	return published.UTC()
+}
+
+// newJobID returns the ID of a job started at the given time, the time followed by a random hex suffix
+func newJobID(started time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Could not read a random job ID suffix: %v", err)
+	}
+	return started.Format("20060102T150405") + "-" + hex.EncodeToString(b), nil
+}
+
+// jobStatus is what the jobs endpoints report about an import job
+type jobStatus struct {
+	ID           string              `json:"id"`
+	Weekly       bool                `json:"weekly"`
+	Status       string              `json:"status"`
+	Phase        string              `json:"phase,omitempty"`
+	Started      time.Time           `json:"started"`
+	Finished     *time.Time          `json:"finished,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	Uploads      []uploadStatus      `json:"uploads,omitempty"`
+	Destinations []destinationStatus `json:"destinations,omitempty"`
+}
+
+type uploadStatus struct {
+	Destination string `json:"destination"`
+	Object      string `json:"object"`
+	Size        int64  `json:"size"`
+	Uploaded    int64  `json:"uploaded"`
+}
+
+type destinationStatus struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// jobRegistry keeps the status of the most recent import jobs and lets a shutdown wait for or abort the running ones;
+// a nil registry records nothing
+type jobRegistry struct {
+	sync.Mutex
+	jobs    []*jobStatus
+	limit   int
+	cancels map[string]context.CancelFunc
+	running sync.WaitGroup
+	closed  bool
+}
+
+func newJobRegistry(limit int) *jobRegistry {
+	return &jobRegistry{limit: limit, cancels: map[string]context.CancelFunc{}}
+}
+
+// start registers a running job, unless the registry is shutting down; the returned context is cancelled
+// when the job is aborted
+func (r *jobRegistry) start(job importJob) (context.Context, error) {
+	if r == nil {
+		return context.Background(), nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return nil, errShuttingDown
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancels[job.id] = cancel
+	r.running.Add(1)
+	r.jobs = append(r.jobs, &jobStatus{ID: job.id, Weekly: job.weekly, Status: jobRunning, Started: job.started})
+	if r.limit > 0 && len(r.jobs) > r.limit {
+		r.jobs = r.jobs[len(r.jobs)-r.limit:]
+	}
+	return ctx, nil
+}
+
+// shutdown stops new jobs from starting and waits up to grace for the running jobs to finish;
+// it then aborts them and waits up to abortWait for them to clean up. It reports whether all jobs finished.
+func (r *jobRegistry) shutdown(grace time.Duration, abortWait time.Duration) bool {
+	if r == nil {
+		return true
+	}
+	r.Lock()
+	r.closed = true
+	r.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(grace):
+	}
+
+	r.Lock()
+	for id, cancel := range r.cancels {
+		log.WithField(jobField, id).Warnf("Aborting import job [%s] after the shutdown grace period", id)
+		cancel()
+	}
+	r.Unlock()
+	select {
+	case <-done:
+		return true
+	case <-time.After(abortWait):
+		return false
+	}
+}
+
+// cancel aborts a running job
+func (r *jobRegistry) cancel(id string) error {
+	if r == nil {
+		return errJobNotFound
+	}
+	r.Lock()
+	defer r.Unlock()
+	if cancel, found := r.cancels[id]; found {
+		cancel()
+		return nil
+	}
+	for _, js := range r.jobs {
+		if js.ID == id {
+			return errJobNotRunning
+		}
+	}
+	return errJobNotFound
+}
+
+func (r *jobRegistry) update(id string, f func(js *jobStatus)) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	for _, js := range r.jobs {
+		if js.ID == id {
+			f(js)
+			return
+		}
+	}
+}
+
+func (r *jobRegistry) setPhase(id string, phase string) {
+	r.update(id, func(js *jobStatus) {
+		js.Phase = phase
+	})
+}
+
+func (r *jobRegistry) finish(id string, err error) {
+	r.update(id, func(js *jobStatus) {
+		finished := time.Now().UTC()
+		js.Finished = &finished
+		js.Status = jobSucceeded
+		if err != nil {
+			js.Status = jobFailed
+			js.Error = err.Error()
+		}
+		if err == errJobAborted {
+			js.Status = jobAborted
+		}
+	})
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	if cancel, found := r.cancels[id]; found {
+		cancel()
+		delete(r.cancels, id)
+		r.running.Done()
+	}
+}
+
+func (r *jobRegistry) reportUpload(id string, destination string, object string, uploaded int64, size int64) {
+	r.update(id, func(js *jobStatus) {
+		for i := range js.Uploads {
+			if js.Uploads[i].Destination == destination && js.Uploads[i].Object == object {
+				js.Uploads[i].Uploaded = uploaded
+				return
+			}
+		}
+		js.Uploads = append(js.Uploads, uploadStatus{Destination: destination, Object: object, Size: size, Uploaded: uploaded})
+	})
+}
+
+func (r *jobRegistry) reportDestinations(id string, results []destinationResult) {
+	r.update(id, func(js *jobStatus) {
+		js.Destinations = nil
+		for _, res := range results {
+			ds := destinationStatus{Name: res.name}
+			if res.err != nil {
+				ds.Error = res.err.Error()
+			}
+			js.Destinations = append(js.Destinations, ds)
+		}
+	})
+}
+
+// get returns a copy of the status of a job
+func (r *jobRegistry) get(id string) (jobStatus, bool) {
+	if r == nil {
+		return jobStatus{}, false
+	}
+	r.Lock()
+	defer r.Unlock()
+	for _, js := range r.jobs {
+		if js.ID == id {
+			return js.copy(), true
+		}
+	}
+	return jobStatus{}, false
+}
+
+// list returns copies of the statuses of all jobs, most recent first
+func (r *jobRegistry) list() []jobStatus {
+	statuses := []jobStatus{}
+	if r == nil {
+		return statuses
+	}
+	r.Lock()
+	defer r.Unlock()
+	for i := len(r.jobs) - 1; i >= 0; i-- {
+		statuses = append(statuses, r.jobs[i].copy())
+	}
+	return statuses
+}
+
+func (js *jobStatus) copy() jobStatus {
+	c := *js
+	c.Uploads = append([]uploadStatus(nil), js.Uploads...)
+	c.Destinations = append([]destinationStatus(nil), js.Destinations...)
+	return c
+}
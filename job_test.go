@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicationDateIsTheMostRecentPackageRelease(t *testing.T) {
+	as := assert.New(t)
+
+	started := time.Date(2017, 4, 3, 0, 5, 0, 0, time.UTC)
+	saturday := time.Date(2017, 4, 1, 18, 0, 0, 0, time.FixedZone("EDT", -4*60*60))
+	friday := time.Date(2017, 3, 31, 18, 0, 0, 0, time.UTC)
+	colls := []zipCollection{
+		{archive: "edm_premium_v1_full_1532.zip", published: friday},
+		{archive: "edm_premium_v1_full_1533.zip", published: saturday},
+	}
+
+	published := publicationDate(colls, started)
+	as.Equal(saturday.UTC(), published)
+	as.Equal(time.UTC, published.Location())
+}
+
+func TestPublicationDateFallsBackToJobStart(t *testing.T) {
+	started := time.Date(2017, 4, 3, 0, 5, 0, 0, time.FixedZone("BST", 60*60))
+	published := publicationDate([]zipCollection{{archive: "edm_premium_v1_1533.zip"}}, started)
+	assert.Equal(t, started.UTC(), published)
+}
+
+func TestJobRegistryTracksStatusAndProgress(t *testing.T) {
+	as := assert.New(t)
+
+	r := newJobRegistry(2)
+	job, err := newImportJob(true)
+	as.NoError(err)
+	r.start(job)
+	r.setPhase(job.id, uploadPhase)
+	r.reportUpload(job.id, primaryDestinationName, "2017-04-01/weekly.zip", 10, 100)
+	r.reportUpload(job.id, primaryDestinationName, "2017-04-01/weekly.zip", 60, 100)
+
+	js, found := r.get(job.id)
+	as.True(found)
+	as.Equal(jobRunning, js.Status)
+	as.Equal(uploadPhase, js.Phase)
+	as.Equal([]uploadStatus{{Destination: primaryDestinationName, Object: "2017-04-01/weekly.zip", Size: 100, Uploaded: 60}}, js.Uploads)
+
+	r.finish(job.id, errors.New("Could not connect to Amazon S3"))
+	js, _ = r.get(job.id)
+	as.Equal(jobFailed, js.Status)
+	as.Equal("Could not connect to Amazon S3", js.Error)
+	as.NotNil(js.Finished)
+
+	r.start(importJob{id: "job2"})
+	r.start(importJob{id: "job3"})
+	_, found = r.get(job.id)
+	as.False(found)
+	list := r.list()
+	as.Len(list, 2)
+	as.Equal("job3", list[0].ID)
+}
+
+func TestNilJobRegistryRecordsNothing(t *testing.T) {
+	as := assert.New(t)
+
+	var r *jobRegistry
+	r.start(importJob{id: "job1"})
+	r.finish("job1", nil)
+	_, found := r.get("job1")
+	as.False(found)
+	as.Empty(r.list())
+}
+
+func TestJobRegistryShutdownWaitsForRunningJobs(t *testing.T) {
+	as := assert.New(t)
+
+	r := newJobRegistry(defaultJobHistory)
+	_, err := r.start(importJob{id: "job1"})
+	as.NoError(err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		r.finish("job1", nil)
+	}()
+
+	as.True(r.shutdown(time.Second, time.Second))
+	js, _ := r.get("job1")
+	as.Equal(jobSucceeded, js.Status)
+
+	_, err = r.start(importJob{id: "job2"})
+	as.Equal(errShuttingDown, err)
+}
+
+func TestJobRegistryShutdownAbortsJobsAfterGracePeriod(t *testing.T) {
+	as := assert.New(t)
+
+	r := newJobRegistry(defaultJobHistory)
+	ctx, err := r.start(importJob{id: "job1"})
+	as.NoError(err)
+	go func() {
+		<-ctx.Done()
+		r.finish("job1", errJobAborted)
+	}()
+
+	as.True(r.shutdown(10*time.Millisecond, time.Second))
+	js, _ := r.get("job1")
+	as.Equal(jobAborted, js.Status)
+	as.Equal(errJobAborted.Error(), js.Error)
+
+	r = newJobRegistry(defaultJobHistory)
+	r.start(importJob{id: "job2"})
+	as.False(r.shutdown(10*time.Millisecond, 10*time.Millisecond))
+}
+
+func TestJobRegistryCancelsRunningJobs(t *testing.T) {
+	as := assert.New(t)
+
+	r := newJobRegistry(defaultJobHistory)
+	ctx, err := r.start(importJob{id: "job1"})
+	as.NoError(err)
+
+	as.NoError(r.cancel("job1"))
+	as.Equal(context.Canceled, ctx.Err())
+	r.finish("job1", errJobAborted)
+	as.Equal(errJobNotRunning, r.cancel("job1"))
+	as.Equal(errJobNotFound, r.cancel("job2"))
+}
+
+func TestCancelJobEndpoint(t *testing.T) {
+	as := assert.New(t)
+
+	s := service{jobs: newJobRegistry(defaultJobHistory)}
+	s.jobs.start(importJob{id: "job1"})
+	s.jobs.start(importJob{id: "job2"})
+	s.jobs.finish("job2", nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/jobs/{id}", s.cancelJob).Methods("DELETE")
+
+	for id, status := range map[string]int{"job1": http.StatusAccepted, "job2": http.StatusConflict, "job3": http.StatusNotFound} {
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, httptest.NewRequest("DELETE", "/jobs/"+id, nil))
+		as.Equal(status, rw.Code, id)
+	}
+}
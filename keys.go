@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultKeyTemplate = "{yyyy}-{mm}-{dd}/{file}"
+const defaultPointerTemplate = "{kind}"
+
+var placeholderRegex = regexp.MustCompile("{[^{}]*}")
+
+var keyPlaceholders = []string{"{env}", "{kind}", "{yyyy}", "{mm}", "{dd}", "{jobId}", "{file}"}
+var pointerPlaceholders = []string{"{env}", "{kind}"}
+
+// keyLayout decides under which keys the bundles, manifests and pointers are stored in the bucket
+type keyLayout struct {
+	keyTemplate     string
+	pointerTemplate string
+	env             string
+}
+
+func newKeyLayout(keyTemplate string, pointerTemplate string, env string) (keyLayout, error) {
+	kl := keyLayout{keyTemplate: keyTemplate, pointerTemplate: pointerTemplate, env: env}
+	if kl.keyTemplate == "" {
+		kl.keyTemplate = defaultKeyTemplate
+	}
+	if kl.pointerTemplate == "" {
+		kl.pointerTemplate = defaultPointerTemplate
+	}
+
+	if err := validateTemplate(kl.keyTemplate, keyPlaceholders, "{file}"); err != nil {
+		return kl, fmt.Errorf("Invalid key template [%s]: %v", kl.keyTemplate, err)
+	}
+	if err := validateTemplate(kl.pointerTemplate, pointerPlaceholders, "{kind}"); err != nil {
+		return kl, fmt.Errorf("Invalid pointer template [%s]: %v", kl.pointerTemplate, err)
+	}
+	if strings.Contains(kl.keyTemplate+kl.pointerTemplate, "{env}") && kl.env == "" {
+		return kl, errors.New("The {env} placeholder is used but no environment is configured")
+	}
+	return kl, nil
+}
+
+func validateTemplate(template string, allowed []string, required string) error {
+	if !strings.Contains(template, required) {
+		return fmt.Errorf("the %s placeholder is mandatory", required)
+	}
+	for _, placeholder := range placeholderRegex.FindAllString(template, -1) {
+		if !containsString(allowed, placeholder) {
+			return fmt.Errorf("unknown placeholder %s", placeholder)
+		}
+	}
+	if strings.HasPrefix(template, "/") {
+		return errors.New("keys must not start with /")
+	}
+	return nil
+}
+
+// dataKey returns the key of a bundle or manifest file of the given kind (daily or weekly)
+func (kl keyLayout) dataKey(kind string, file string, jobID string, date time.Time) string {
+	template := kl.keyTemplate
+	if template == "" {
+		template = defaultKeyTemplate
+	}
+	r := strings.NewReplacer(
+		"{env}", kl.env,
+		"{kind}", kind,
+		"{yyyy}", date.Format("2006"),
+		"{mm}", date.Format("01"),
+		"{dd}", date.Format("02"),
+		"{jobId}", jobID,
+		"{file}", file,
+	)
+	return r.Replace(template)
+}
+
+// pointerKey returns the key of the object pointing to the latest bundle of the given kind
+func (kl keyLayout) pointerKey(kind string) string {
+	template := kl.pointerTemplate
+	if template == "" {
+		template = defaultPointerTemplate
+	}
+	r := strings.NewReplacer("{env}", kl.env, "{kind}", kind)
+	return r.Replace(template)
+}
+
+// dataKeyInfo is what can be read back from a key built by dataKey; date is only known if the template contains it
+type dataKeyInfo struct {
+	kind  string
+	file  string
+	jobID string
+	date  time.Time
+}
+
+var placeholderPatterns = map[string]string{
+	"{kind}":  "([^/]+)",
+	"{yyyy}":  "([0-9]{4})",
+	"{mm}":    "([0-9]{2})",
+	"{dd}":    "([0-9]{2})",
+	"{jobId}": "([^/]+)",
+	"{file}":  "([^/]+)",
+}
+
+// parseDataKey reverses dataKey, returning false for keys that were not built from the key template
+func (kl keyLayout) parseDataKey(key string) (dataKeyInfo, bool) {
+	template := kl.keyTemplate
+	if template == "" {
+		template = defaultKeyTemplate
+	}
+	var groups []string
+	pattern := "^"
+	last := 0
+	for _, loc := range placeholderRegex.FindAllStringIndex(template, -1) {
+		pattern += regexp.QuoteMeta(template[last:loc[0]])
+		placeholder := template[loc[0]:loc[1]]
+		if placeholder == "{env}" {
+			pattern += regexp.QuoteMeta(kl.env)
+		} else {
+			pattern += placeholderPatterns[placeholder]
+			groups = append(groups, placeholder)
+		}
+		last = loc[1]
+	}
+	pattern += regexp.QuoteMeta(template[last:]) + "$"
+
+	match := regexp.MustCompile(pattern).FindStringSubmatch(key)
+	if match == nil {
+		return dataKeyInfo{}, false
+	}
+	values := map[string]string{}
+	for i, g := range groups {
+		if _, found := values[g]; !found {
+			values[g] = match[i+1]
+		}
+	}
+
+	info := dataKeyInfo{file: values["{file}"], jobID: values["{jobId}"]}
+	// only the bundles and manifests the writer publishes are data keys, not other files that happen to match
+	for _, kind := range []string{daily, weekly} {
+		if info.file == kind+".zip" || info.file == manifestName(kind+".zip") {
+			info.kind = kind
+		}
+	}
+	if info.kind == "" {
+		return dataKeyInfo{}, false
+	}
+	if kind, found := values["{kind}"]; found && kind != info.kind {
+		return dataKeyInfo{}, false
+	}
+	if values["{yyyy}"] != "" && values["{mm}"] != "" && values["{dd}"] != "" {
+		date, err := time.Parse("2006-01-02", values["{yyyy}"]+"-"+values["{mm}"]+"-"+values["{dd}"])
+		if err != nil {
+			return dataKeyInfo{}, false
+		}
+		info.date = date
+	}
+	return info, true
+}
+
+// listPrefix returns the fixed part of the key template all data keys start with
+func (kl keyLayout) listPrefix() string {
+	template := kl.keyTemplate
+	if template == "" {
+		template = defaultKeyTemplate
+	}
+	template = strings.Replace(template, "{env}", kl.env, -1)
+	if loc := placeholderRegex.FindStringIndex(template); loc != nil {
+		return template[:loc[0]]
+	}
+	return template
+}
+
+// resourceLayout is the key and pointer template of resources published under keys of their own,
+// in place of those of the destinations; the zero value keeps the templates of each destination
+type resourceLayout struct {
+	keyTemplate     string
+	pointerTemplate string
+}
+
+// apply returns the destinations with the templates of the layout
+func (rl resourceLayout) apply(destinations []destination) []destination {
+	if rl == (resourceLayout{}) {
+		return destinations
+	}
+	applied := make([]destination, len(destinations))
+	for i, d := range destinations {
+		d.config.keyTemplate = rl.keyTemplate
+		d.config.pointerTemplate = rl.pointerTemplate
+		applied[i] = d
+	}
+	return applied
+}
+
+// keys returns the key layout of the layout in a destination
+func (rl resourceLayout) keys(config s3Config) (keyLayout, error) {
+	if rl == (resourceLayout{}) {
+		return newKeyLayout(config.keyTemplate, config.pointerTemplate, config.env)
+	}
+	return newKeyLayout(rl.keyTemplate, rl.pointerTemplate, config.env)
+}
+
+// resourceGroup is a set of resources with the same layout, published together in one bundle per kind
+type resourceGroup struct {
+	layout resourceLayout
+	files  []factsetResource
+}
+
+// groupResources groups the resources by their layout, in the order the layouts first appear
+func groupResources(files []factsetResource) []resourceGroup {
+	var groups []resourceGroup
+	index := map[resourceLayout]int{}
+	for _, res := range files {
+		i, found := index[res.layout]
+		if !found {
+			i = len(groups)
+			index[res.layout] = i
+			groups = append(groups, resourceGroup{layout: res.layout})
+		}
+		groups[i].files = append(groups[i].files, res)
+	}
+	return groups
+}
+
+// resourceLayouts returns the layout of the destinations followed by the own layouts of the resources
+func resourceLayouts(files []factsetResource) []resourceLayout {
+	layouts := []resourceLayout{{}}
+	for _, g := range groupResources(files) {
+		if g.layout != (resourceLayout{}) {
+			layouts = append(layouts, g.layout)
+		}
+	}
+	return layouts
+}
+
+// validateResourceLayouts checks the layouts of the resources against every destination: the templates have to be
+// valid, and no two layouts may share pointers or data keys, or one would overwrite or expire the files of the other
+func validateResourceLayouts(files []factsetResource, destinations []destination) error {
+	for _, res := range files {
+		if res.layout != (resourceLayout{}) && (res.layout.keyTemplate == "" || res.layout.pointerTemplate == "") {
+			return fmt.Errorf("Resource [%s] needs both a key and a pointer template", res.archive)
+		}
+	}
+	layouts := resourceLayouts(files)
+	for _, d := range destinations {
+		var built []keyLayout
+		for _, rl := range layouts {
+			kl, err := rl.keys(d.config)
+			if err != nil {
+				return fmt.Errorf("Destination [%s]: %v", d.name, err)
+			}
+			if err := d.config.retention.validate(kl); err != nil {
+				return fmt.Errorf("Destination [%s]: %v", d.name, err)
+			}
+			for _, other := range built {
+				if kl.overlaps(other) {
+					return fmt.Errorf("Destination [%s]: the layouts [%s, %s] and [%s, %s] share keys", d.name,
+						kl.keyTemplate, kl.pointerTemplate, other.keyTemplate, other.pointerTemplate)
+				}
+			}
+			built = append(built, kl)
+		}
+	}
+	return nil
+}
+
+// overlaps tells whether two layouts have the same pointers, or keys of one layout that the other would take for its own
+func (kl keyLayout) overlaps(other keyLayout) bool {
+	if kl.pointerKey(daily) == other.pointerKey(daily) {
+		return true
+	}
+	date := time.Date(2017, 4, 1, 0, 0, 0, 0, time.UTC)
+	for _, file := range []string{daily + ".zip", manifestName(daily + ".zip")} {
+		if _, ok := other.parseDataKey(kl.dataKey(daily, file, "job", date)); ok {
+			return true
+		}
+		if _, ok := kl.parseDataKey(other.dataKey(daily, file, "job", date)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyLayoutDefaultsKeepDatedFoldersAtTheBucketRoot(t *testing.T) {
+	as := assert.New(t)
+
+	kl, err := newKeyLayout("", "", "")
+	as.NoError(err)
+	date := time.Date(2017, 4, 3, 23, 59, 0, 0, time.UTC)
+	as.Equal("2017-04-03/daily.zip", kl.dataKey(daily, "daily.zip", "job1", date))
+	as.Equal("daily", kl.pointerKey(daily))
+	as.Equal("2017-04-03/weekly.zip", keyLayout{}.dataKey(weekly, "weekly.zip", "job1", date))
+	as.Equal("weekly", keyLayout{}.pointerKey(weekly))
+}
+
+func TestKeyLayoutFillsInAllPlaceholders(t *testing.T) {
+	as := assert.New(t)
+
+	kl, err := newKeyLayout("factset/{env}/{kind}/{yyyy}/{mm}/{dd}/{jobId}/{file}", "factset/{env}/latest/{kind}", "prod")
+	as.NoError(err)
+	date := time.Date(2017, 4, 3, 10, 0, 0, 0, time.UTC)
+	as.Equal("factset/prod/weekly/2017/04/03/job1/weekly.manifest.json", kl.dataKey(weekly, "weekly.manifest.json", "job1", date))
+	as.Equal("factset/prod/latest/weekly", kl.pointerKey(weekly))
+}
+
+func TestNewKeyLayoutRejectsInvalidTemplates(t *testing.T) {
+	as := assert.New(t)
+
+	tcs := []struct {
+		keyTemplate     string
+		pointerTemplate string
+		env             string
+	}{
+		{keyTemplate: "factset/{yyyy}/{mm}/{dd}"},
+		{keyTemplate: "factset/{year}/{file}"},
+		{keyTemplate: "/factset/{file}"},
+		{pointerTemplate: "latest"},
+		{pointerTemplate: "{kind}/{jobId}"},
+		{keyTemplate: "factset/{env}/{file}"},
+	}
+
+	for _, tc := range tcs {
+		_, err := newKeyLayout(tc.keyTemplate, tc.pointerTemplate, tc.env)
+		as.Error(err, "%v", tc)
+	}
+}
+
+func TestKeyLayoutParsesDataKeys(t *testing.T) {
+	as := assert.New(t)
+
+	kl, err := newKeyLayout("factset/{env}/{kind}/{yyyy}/{mm}/{dd}/{jobId}/{file}", "", "prod")
+	as.NoError(err)
+	as.Equal("factset/prod/", kl.listPrefix())
+	info, ok := kl.parseDataKey("factset/prod/weekly/2017/04/03/job1/weekly.manifest.json")
+	as.True(ok)
+	as.Equal(dataKeyInfo{kind: weekly, file: "weekly.manifest.json", jobID: "job1", date: time.Date(2017, 4, 3, 0, 0, 0, 0, time.UTC)}, info)
+
+	_, ok = kl.parseDataKey("factset/test/weekly/2017/04/03/job1/weekly.zip")
+	as.False(ok)
+	_, ok = kl.parseDataKey("factset/prod/daily/2017/04/03/job1/weekly.zip")
+	as.False(ok)
+
+	info, ok = keyLayout{}.parseDataKey("2017-04-03/daily.zip")
+	as.True(ok)
+	as.Equal(daily, info.kind)
+	as.Equal("", keyLayout{}.listPrefix())
+	_, ok = keyLayout{}.parseDataKey("daily")
+	as.False(ok)
+	_, ok = keyLayout{}.parseDataKey("2017-04-03/daily.csv")
+	as.False(ok)
+	_, ok = keyLayout{}.parseDataKey("2017-04-03/daily.zip.bak")
+	as.False(ok)
+}
+
+func TestGroupResourcesByLayout(t *testing.T) {
+	as := assert.New(t)
+
+	own := resourceLayout{keyTemplate: "factset/fundamentals/{yyyy}/{file}", pointerTemplate: "factset/fundamentals/{kind}"}
+	files := []factsetResource{{archive: "edm_premium"}, {archive: "ff_basic", layout: own}, {archive: "edm_bbg_ids"}}
+	as.Equal([]resourceGroup{
+		{files: []factsetResource{files[0], files[2]}},
+		{layout: own, files: []factsetResource{files[1]}},
+	}, groupResources(files))
+	as.Equal([]resourceLayout{{}, own}, resourceLayouts(files))
+	as.Equal([]resourceLayout{{}}, resourceLayouts(files[:1]))
+
+	d := destination{name: primaryDestinationName, config: s3Config{keyTemplate: "factset/{file}", env: "prod"}}
+	as.Equal("factset/fundamentals/{yyyy}/{file}", own.apply([]destination{d})[0].config.keyTemplate)
+	as.Equal("factset/{file}", resourceLayout{}.apply([]destination{d})[0].config.keyTemplate)
+}
+
+func TestValidateResourceLayoutsRejectsSharedKeys(t *testing.T) {
+	as := assert.New(t)
+
+	dests := []destination{{name: primaryDestinationName, config: s3Config{keyTemplate: "factset/{kind}/{yyyy}/{mm}/{dd}/{file}"}}}
+	resource := func(keyTemplate string, pointerTemplate string) factsetResource {
+		return factsetResource{archive: "ff_basic", layout: resourceLayout{keyTemplate: keyTemplate, pointerTemplate: pointerTemplate}}
+	}
+
+	as.NoError(validateResourceLayouts([]factsetResource{{archive: "edm_premium"}, resource("fundamentals/{kind}/{jobId}/{file}", "fundamentals/{kind}")}, dests))
+	as.NoError(validateResourceLayouts([]factsetResource{resource("fundamentals/{file}", "fundamentals/{kind}")}, dests))
+
+	tcs := []factsetResource{
+		resource("fundamentals/{file}", ""),
+		resource("fundamentals/{year}/{file}", "fundamentals/{kind}"),
+		resource("fundamentals/{file}", "{kind}"),
+		resource("factset/{kind}/{yyyy}/{mm}/{dd}/{file}", "fundamentals/{kind}"),
+		resource("factset/{kind}/{jobId}/{dd}/{mm}/{file}", "fundamentals/{kind}"),
+	}
+	for _, tc := range tcs {
+		as.Error(validateResourceLayouts([]factsetResource{{archive: "edm_premium"}, tc}, dests), "%v", tc.layout)
+	}
+
+	dests[0].config.retention = retentionPolicy{dailyDays: 7}
+	as.Error(validateResourceLayouts([]factsetResource{resource("{yyyy}/{file}", "fundamentals/{kind}")}, dests))
+}
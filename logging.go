@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Fields of the structured log lines, so the lines of one import can be filtered
+const (
+	jobField         = "jobId"
+	resourceField    = "resource"
+	archiveField     = "archive"
+	phaseField       = "phase"
+	destinationField = "destination"
+	objectField      = "object"
+	bytesField       = "bytes"
+	durationField    = "duration"
+)
+
+const (
+	jsonLogFormat = "json"
+	textLogFormat = "text"
+)
+
+// configureLogging sets the level and the format of the log
+func configureLogging(level string, format string) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case jsonLogFormat:
+		log.SetFormatter(&log.JSONFormatter{})
+	case textLogFormat:
+		log.SetFormatter(&log.TextFormatter{})
+	default:
+		return fmt.Errorf("Unknown log format [%s], expected %s or %s", format, jsonLogFormat, textLogFormat)
+	}
+	log.SetLevel(lvl)
+	return nil
+}
+
+// jobLog returns a logger adding the job ID to every line
+func jobLog(jobID string) *log.Entry {
+	return log.WithField(jobField, jobID)
+}
+
+// orDefaultLog returns the logger, or one without fields if there is none
+func orDefaultLog(l *log.Entry) *log.Entry {
+	if l == nil {
+		return log.NewEntry(log.StandardLogger())
+	}
+	return l
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureLogging(t *testing.T) {
+	as := assert.New(t)
+	defer log.SetLevel(log.GetLevel())
+
+	as.NoError(configureLogging("debug", jsonLogFormat))
+	as.Equal(log.DebugLevel, log.GetLevel())
+	as.IsType(&log.JSONFormatter{}, log.StandardLogger().Formatter)
+
+	as.NoError(configureLogging("warning", textLogFormat))
+	as.Equal(log.WarnLevel, log.GetLevel())
+
+	as.Error(configureLogging("verbose", jsonLogFormat))
+	as.Error(configureLogging("info", "xml"))
+}
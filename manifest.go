@@ -0,0 +1,171 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const manifestSuffix = ".manifest.json"
+
+type manifest struct {
+	JobID           string            `json:"jobId"`
+	Bundle          string            `json:"bundle"`
+	JobStarted      time.Time         `json:"jobStarted"`
+	PublicationDate time.Time         `json:"publicationDate"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	Archives        []manifestArchive `json:"archives"`
+	Files           []manifestFile    `json:"files"`
+}
+
+type manifestArchive struct {
+	Name         string    `json:"name"`
+	MajorVersion int       `json:"majorVersion"`
+	MinorVersion int       `json:"minorVersion"`
+	Published    time.Time `json:"published"`
+}
+
+type manifestFile struct {
+	Name    string `json:"name"`
+	Archive string `json:"archive"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Rows    int    `json:"rows"`
+}
+
+// lineCounter counts the lines of whatever is written to it
+type lineCounter struct {
+	lines    int
+	lastByte byte
+}
+
+func (lc *lineCounter) Write(p []byte) (int, error) {
+	lc.lines += bytes.Count(p, []byte{'\n'})
+	if len(p) > 0 {
+		lc.lastByte = p[len(p)-1]
+	}
+	return len(p), nil
+}
+
+// bundleKind returns the local folder (and bundle) the files of an archive are extracted to
+func bundleKind(archive string) string {
+	if strings.Contains(archive, "full") {
+		return weekly
+	}
+	return daily
+}
+
+func manifestName(bundle string) string {
+	return fileKind(bundle) + manifestSuffix
+}
+
+func newManifest(job importJob, bundle string, colls []zipCollection) (manifest, error) {
+	m := manifest{
+		JobID:           job.id,
+		Bundle:          bundle,
+		JobStarted:      job.started,
+		PublicationDate: job.published,
+		Archives:        []manifestArchive{},
+		Files:           []manifestFile{},
+	}
+	kind := fileKind(bundle)
+	rd := FactsetReader{}
+	for _, coll := range colls {
+		if coll.archive == "" || bundleKind(coll.archive) != kind {
+			continue
+		}
+		majorVersion, err := rd.getMajorVersion(coll.archive)
+		if err != nil {
+			return m, err
+		}
+		minorVersion, err := rd.getMinorVersion(coll.archive)
+		if err != nil {
+			return m, err
+		}
+		m.Archives = append(m.Archives, manifestArchive{Name: coll.archive, MajorVersion: majorVersion, MinorVersion: minorVersion, Published: coll.published})
+
+		for _, fileName := range coll.filesToWrite {
+			mf, err := describeFile(path.Join(dataFolder, kind, fileName))
+			if err != nil {
+				return m, err
+			}
+			mf.Name = fileName
+			mf.Archive = coll.archive
+			m.Files = append(m.Files, mf)
+		}
+	}
+	m.CreatedAt = time.Now().UTC()
+	return m, nil
+}
+
+// newLocalManifest describes a bundle zipped beforehand by the files in the zip; the Factset packages they were
+// extracted from are not known, so it lists no archives
+func newLocalManifest(job importJob, src string, bundle string) (manifest, error) {
+	m, err := newManifest(job, bundle, nil)
+	if err != nil {
+		return m, err
+	}
+	zr, err := zip.OpenReader(path.Join(src, bundle))
+	if err != nil {
+		return m, err
+	}
+	defer zr.Close()
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return m, err
+		}
+		mf, err := describe(r)
+		r.Close()
+		if err != nil {
+			return m, err
+		}
+		mf.Name = zf.Name
+		m.Files = append(m.Files, mf)
+	}
+	return m, nil
+}
+
+func describeFile(filePath string) (manifestFile, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return manifestFile{}, err
+	}
+	defer f.Close()
+	return describe(f)
+}
+
+// describe returns the size, SHA-256 and number of rows of a file read from r
+func describe(r io.Reader) (manifestFile, error) {
+	h := sha256.New()
+	lc := &lineCounter{}
+	n, err := io.Copy(io.MultiWriter(h, lc), r)
+	if err != nil {
+		return manifestFile{}, err
+	}
+
+	lines := lc.lines
+	if n > 0 && lc.lastByte != '\n' {
+		lines++
+	}
+	// Factset files start with a header line which is not counted as a row
+	rows := 0
+	if lines > 0 {
+		rows = lines - 1
+	}
+	return manifestFile{Size: n, SHA256: hex.EncodeToString(h.Sum(nil)), Rows: rows}, nil
+}
+
+func (m manifest) marshal() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
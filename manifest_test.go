@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewManifestDescribesOnlyFilesOfTheBundle(t *testing.T) {
+	as := assert.New(t)
+
+	weeklyCollection := zipCollection{archive: "edm_premium_v1_full_1532.zip", filesToWrite: []string{"edm_entity.txt"}}
+	dailyCollection := zipCollection{archive: "edm_premium_v1_1533.zip", filesToWrite: []string{"edm_entity_update.txt"}}
+	os.Mkdir(path.Join(dataFolder, weekly), 0755)
+	os.Mkdir(path.Join(dataFolder, daily), 0755)
+	defer removeCreatedDirectoriesAndFiles()
+	err := ioutil.WriteFile(path.Join(dataFolder, weekly, "edm_entity.txt"), []byte("\"ID\"|\"NAME\"\n\"1\"|\"one\"\n\"2\"|\"two\""), 0644)
+	as.NoError(err)
+	err = ioutil.WriteFile(path.Join(dataFolder, daily, "edm_entity_update.txt"), []byte("\"ID\"|\"NAME\"\r\n"), 0644)
+	as.NoError(err)
+
+	job, err := newImportJob(false)
+	as.NoError(err)
+	m, err := newManifest(job, "weekly.zip", []zipCollection{weeklyCollection, dailyCollection})
+	as.NoError(err)
+	as.Equal(job.id, m.JobID)
+	as.Equal("weekly.zip", m.Bundle)
+	as.Equal([]manifestArchive{{Name: "edm_premium_v1_full_1532.zip", MajorVersion: 1, MinorVersion: 1532}}, m.Archives)
+	as.Len(m.Files, 1)
+	as.Equal("edm_entity.txt", m.Files[0].Name)
+	as.Equal("edm_premium_v1_full_1532.zip", m.Files[0].Archive)
+	as.Equal(int64(31), m.Files[0].Size)
+	as.Equal(2, m.Files[0].Rows)
+	as.Len(m.Files[0].SHA256, 64)
+
+	m, err = newManifest(job, "daily.zip", []zipCollection{weeklyCollection, dailyCollection})
+	as.NoError(err)
+	as.Len(m.Files, 1)
+	as.Equal(0, m.Files[0].Rows)
+
+	data, err := m.marshal()
+	as.NoError(err)
+	var decoded manifest
+	as.NoError(json.Unmarshal(data, &decoded))
+	as.Equal(m.JobID, decoded.JobID)
+	as.Equal(m.Files, decoded.Files)
+}
+
+func TestNewManifestReturnsErrorWhenFileIsMissing(t *testing.T) {
+	as := assert.New(t)
+
+	coll := zipCollection{archive: "edm_premium_v1_1533.zip", filesToWrite: []string{"missing_update.txt"}}
+	job, err := newImportJob(false)
+	as.NoError(err)
+	_, err = newManifest(job, "daily.zip", []zipCollection{coll})
+	as.Error(err)
+}
+
+func TestNewLocalManifestDescribesTheZippedFiles(t *testing.T) {
+	as := assert.New(t)
+
+	src, err := ioutil.TempDir("", "publish")
+	as.NoError(err)
+	defer os.RemoveAll(src)
+	f, err := os.Create(path.Join(src, "daily.zip"))
+	as.NoError(err)
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("edm_entity_update.txt")
+	as.NoError(err)
+	_, err = w.Write([]byte("\"ID\"|\"NAME\"\n\"1\"|\"one\"\n"))
+	as.NoError(err)
+	as.NoError(zw.Close())
+	as.NoError(f.Close())
+
+	job, err := newImportJob(false)
+	as.NoError(err)
+	m, err := newLocalManifest(job, src, "daily.zip")
+	as.NoError(err)
+	as.Equal(job.id, m.JobID)
+	as.Empty(m.Archives)
+	as.Len(m.Files, 1)
+	as.Equal("edm_entity_update.txt", m.Files[0].Name)
+	as.Equal(int64(22), m.Files[0].Size)
+	as.Equal(1, m.Files[0].Rows)
+	as.Len(m.Files[0].SHA256, 64)
+
+	_, err = newLocalManifest(job, src, "weekly.zip")
+	as.Error(err)
+}
+
+func TestManifestName(t *testing.T) {
+	assert.Equal(t, "daily.manifest.json", manifestName("daily.zip"))
+	assert.Equal(t, "weekly.manifest.json", manifestName("weekly.zip"))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "factset_reader"
+
+// unzipStep is timed next to the download, zip and upload phases; it is part of the download phase of a job
+const unzipStep = "unzip"
+
+var (
+	sftpConnectDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "sftp_connect_duration_seconds",
+		Help:      "Time taken to connect to the Factset sftp server",
+	})
+	downloadedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Bytes of Factset packages downloaded per resource",
+	}, []string{"resource"})
+	stepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "step_duration_seconds",
+		Help:      "Time taken to download or unzip a Factset package, to zip a bundle or to upload a bundle to a destination",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"step"})
+	jobsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "jobs_total",
+		Help:      "Import jobs by type (daily or weekly) and outcome (succeeded or failed)",
+	}, []string{"type", "outcome"})
+	lastSuccessfulImport = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_successful_import_timestamp_seconds",
+		Help:      "Unix time of the last import that published a resource",
+	}, []string{"resource"})
+	healthcheckResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "healthcheck_results_total",
+		Help:      "Healthcheck runs by check and result (ok or failed)",
+	}, []string{"check", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(sftpConnectDuration, downloadedBytes, stepDuration, jobsTotal, lastSuccessfulImport, healthcheckResults)
+}
+
+// observeStep records the time taken by a step since start
+func observeStep(step string, start time.Time) {
+	stepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+}
+
+func recordJob(job importJob, err error) {
+	jobType := daily
+	if job.weekly {
+		jobType = weekly
+	}
+	outcome := jobSucceeded
+	if err != nil {
+		outcome = jobFailed
+	}
+	jobsTotal.WithLabelValues(jobType, outcome).Inc()
+}
+
+func recordHealthcheck(check string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+	healthcheckResults.WithLabelValues(check, result).Inc()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordJob(t *testing.T) {
+	as := assert.New(t)
+
+	failed := testutil.ToFloat64(jobsTotal.WithLabelValues(weekly, jobFailed))
+	recordJob(importJob{weekly: true}, errors.New("Did not find any matching files"))
+	as.Equal(failed+1, testutil.ToFloat64(jobsTotal.WithLabelValues(weekly, jobFailed)))
+
+	succeeded := testutil.ToFloat64(jobsTotal.WithLabelValues(daily, jobSucceeded))
+	recordJob(importJob{}, nil)
+	as.Equal(succeeded+1, testutil.ToFloat64(jobsTotal.WithLabelValues(daily, jobSucceeded)))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	as := assert.New(t)
+
+	recordHealthcheck(factsetCheck, nil)
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	as.Equal(200, rec.Code)
+	as.True(strings.Contains(rec.Body.String(), `factset_reader_healthcheck_results_total{check="factset-connectivity",result="ok"}`))
+}
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 const dataFolder = "data"
 const weekly = "weekly"
 const daily = "daily"
@@ -7,13 +9,37 @@ const daily = "daily"
 type factsetResource struct {
 	archive   string
 	fileNames string
+	layout    resourceLayout
 }
 
 type s3Config struct {
-	accKey    string
-	secretKey string
-	bucket    string
-	domain    string
+	backend         string
+	accKey          string
+	secretKey       string
+	bucket          string
+	domain          string
+	keyTemplate     string
+	pointerTemplate string
+	env             string
+	sse             string
+	kmsKeyID        string
+	storageClasses  map[string]string
+	tags            map[string]string
+	region          string
+	credentials     string
+	profile         string
+	roleARN         string
+	roleSessionName string
+	stsEndpoint     string
+	azureAccount    string
+	azureSASToken   string
+	sftpPush        sftpConfig
+	retention       retentionPolicy
+	uploadAttempts  int
+	partSize        int64
+	uploadThreads   int
+	destination     string
+	events          *eventEmitter
 }
 
 type sftpConfig struct {
@@ -26,4 +52,5 @@ type sftpConfig struct {
 type zipCollection struct {
 	archive      string
 	filesToWrite []string
+	published    time.Time
 }
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notifyTimeout bounds sending a notification, including the whole exchange with the smtp server
+const notifyTimeout = 10 * time.Second
+
+// Events notified about an import job
+const (
+	jobFailedEvent    = "failed"
+	jobRecoveredEvent = "recovered"
+	jobSucceededEvent = "succeeded"
+)
+
+// jobEvent is what notifiers are told about a finished import job
+type jobEvent struct {
+	Event     string    `json:"event"`
+	JobID     string    `json:"jobId"`
+	Weekly    bool      `json:"weekly"`
+	Resources []string  `json:"resources"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Error     string    `json:"error,omitempty"`
+	Status    string    `json:"status"`
+}
+
+func (e jobEvent) summary() string {
+	kind := daily
+	if e.Weekly {
+		kind = weekly
+	}
+	switch e.Event {
+	case jobFailedEvent:
+		return fmt.Sprintf("Factset %s import job [%s] failed: %s", kind, e.JobID, e.Error)
+	case jobRecoveredEvent:
+		return fmt.Sprintf("Factset %s import job [%s] succeeded after a failed import", kind, e.JobID)
+	}
+	return fmt.Sprintf("Factset %s import job [%s] succeeded", kind, e.JobID)
+}
+
+func (e jobEvent) text() string {
+	return fmt.Sprintf("%s\nResources: %s\nStatus: %s", e.summary(), strings.Join(e.Resources, ", "), e.Status)
+}
+
+type notifier interface {
+	Notify(ctx context.Context, e jobEvent) error
+}
+
+// webhookNotifier posts the event as JSON
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n webhookNotifier) Notify(ctx context.Context, e jobEvent) error {
+	return postJSON(ctx, n.client, n.url, e)
+}
+
+// slackNotifier posts the event as the text of a Slack incoming webhook message
+type slackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n slackNotifier) Notify(ctx context.Context, e jobEvent) error {
+	return postJSON(ctx, n.client, n.url, map[string]string{"text": e.text()})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// emailNotifier sends the event as a plain text email
+type emailNotifier struct {
+	address  string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// Notify sends the email like smtp.SendMail, but gives up once ctx is done or notifyTimeout has passed,
+// so a server that does not answer cannot hold up the job
+func (n emailNotifier) Notify(ctx context.Context, e jobEvent) error {
+	host, _, err := net.SplitHostPort(n.address)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(notifyTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn, err := net.DialTimeout("tcp", n.address, deadline.Sub(time.Now()))
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		n.from, strings.Join(n.to, ", "), e.summary(), strings.Replace(e.text(), "\n", "\r\n", -1))
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// notifyConfig holds the notifier settings
+type notifyConfig struct {
+	webhookURL   string
+	slackURL     string
+	smtpAddress  string
+	smtpUsername string
+	smtpPassword string
+	emailFrom    string
+	emailTo      string
+	onSuccess    bool
+	baseURL      string
+}
+
+// jobNotifier tells the notifiers about failed jobs, about the first successful job of a kind after a failed one,
+// and, with onSuccess, about every successful job
+type jobNotifier struct {
+	sync.Mutex
+	notifiers []notifier
+	onSuccess bool
+	baseURL   string
+	failed    map[string]bool
+}
+
+func newJobNotifier(config notifyConfig) (*jobNotifier, error) {
+	client := &http.Client{Timeout: notifyTimeout}
+	jn := &jobNotifier{onSuccess: config.onSuccess, baseURL: strings.TrimSuffix(config.baseURL, "/"), failed: map[string]bool{}}
+	if config.webhookURL != "" {
+		jn.notifiers = append(jn.notifiers, webhookNotifier{url: config.webhookURL, client: client})
+	}
+	if config.slackURL != "" {
+		jn.notifiers = append(jn.notifiers, slackNotifier{url: config.slackURL, client: client})
+	}
+	if config.smtpAddress != "" {
+		if config.emailFrom == "" || config.emailTo == "" {
+			return nil, errors.New("Email notifications need a sender and recipients")
+		}
+		if _, _, err := net.SplitHostPort(config.smtpAddress); err != nil {
+			return nil, fmt.Errorf("Invalid smtp address [%s]: %v", config.smtpAddress, err)
+		}
+		var to []string
+		for _, r := range strings.Split(config.emailTo, ",") {
+			to = append(to, strings.TrimSpace(r))
+		}
+		jn.notifiers = append(jn.notifiers, emailNotifier{address: config.smtpAddress, username: config.smtpUsername, password: config.smtpPassword, from: config.emailFrom, to: to})
+	}
+	return jn, nil
+}
+
+// jobFinished notifies about a finished job if it failed, recovered from a failure or if every success is notified;
+// the notifications are given up once the job context is cancelled, as it is when the job is aborted on shutdown
+func (jn *jobNotifier) jobFinished(ctx context.Context, job importJob, resources []factsetResource, jobErr error) {
+	if jn == nil || len(jn.notifiers) == 0 {
+		return
+	}
+	e := jn.event(job, resources, jobErr)
+	if e.Event == "" {
+		return
+	}
+	l := jobLog(job.id)
+	for _, n := range jn.notifiers {
+		if err := n.Notify(ctx, e); err != nil {
+			l.Errorf("Could not send %s notification: %v", e.Event, err)
+		}
+	}
+}
+
+func (jn *jobNotifier) event(job importJob, resources []factsetResource, jobErr error) jobEvent {
+	kind := jobKind(job)
+	jn.Lock()
+	failedBefore := jn.failed[kind]
+	jn.failed[kind] = jobErr != nil
+	jn.Unlock()
+
+	e := jobEvent{JobID: job.id, Weekly: job.weekly, Resources: []string{}, Started: job.started, Finished: time.Now().UTC(), Status: jn.baseURL + "/jobs/" + job.id}
+	for _, res := range resources {
+		e.Resources = append(e.Resources, res.archive)
+	}
+	switch {
+	case jobErr != nil:
+		e.Event = jobFailedEvent
+		e.Error = jobErr.Error()
+	case failedBefore:
+		e.Event = jobRecoveredEvent
+	case jn.onSuccess:
+		e.Event = jobSucceededEvent
+	}
+	return e
+}
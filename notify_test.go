@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobNotifierEvents(t *testing.T) {
+	as := assert.New(t)
+
+	jn, err := newJobNotifier(notifyConfig{baseURL: "http://factset-reader:8080/"})
+	as.NoError(err)
+	resources := getResourceList("/datafeeds/edm/edm_premium/edm_premium:edm_security_entity_map.txt")
+	failure := errors.New("Did not find any matching files")
+
+	e := jn.event(importJob{id: "job1"}, resources, failure)
+	as.Equal(jobFailedEvent, e.Event)
+	as.Equal(failure.Error(), e.Error)
+	as.Equal([]string{"/datafeeds/edm/edm_premium/edm_premium"}, e.Resources)
+	as.Equal("http://factset-reader:8080/jobs/job1", e.Status)
+
+	as.Equal("", jn.event(importJob{id: "job2", weekly: true}, resources, nil).Event)
+	as.Equal(jobRecoveredEvent, jn.event(importJob{id: "job3"}, resources, nil).Event)
+	as.Equal("", jn.event(importJob{id: "job4"}, resources, nil).Event)
+
+	jn.onSuccess = true
+	as.Equal(jobSucceededEvent, jn.event(importJob{id: "job5"}, resources, nil).Event)
+}
+
+func TestJobNotifierPostsToWebhooks(t *testing.T) {
+	as := assert.New(t)
+
+	var webhook jobEvent
+	var slack map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slack" {
+			json.NewDecoder(req.Body).Decode(&slack)
+			return
+		}
+		json.NewDecoder(req.Body).Decode(&webhook)
+	}))
+	defer server.Close()
+
+	jn, err := newJobNotifier(notifyConfig{webhookURL: server.URL + "/webhook", slackURL: server.URL + "/slack", baseURL: "http://factset-reader:8080"})
+	as.NoError(err)
+	jn.jobFinished(context.Background(), importJob{id: "job1", weekly: true}, nil, errors.New("Connection refused"))
+
+	as.Equal("job1", webhook.JobID)
+	as.Equal(jobFailedEvent, webhook.Event)
+	as.True(strings.HasPrefix(slack["text"], "Factset weekly import job [job1] failed: Connection refused"))
+	as.True(strings.Contains(slack["text"], "http://factset-reader:8080/jobs/job1"))
+}
+
+func TestNewJobNotifierValidatesEmailSettings(t *testing.T) {
+	as := assert.New(t)
+
+	_, err := newJobNotifier(notifyConfig{smtpAddress: "smtp.example.com:587", emailTo: "ops@example.com"})
+	as.Error(err)
+	_, err = newJobNotifier(notifyConfig{smtpAddress: "smtp.example.com", emailFrom: "factset-reader@example.com", emailTo: "ops@example.com"})
+	as.Error(err)
+	jn, err := newJobNotifier(notifyConfig{smtpAddress: "smtp.example.com:587", emailFrom: "factset-reader@example.com", emailTo: "ops@example.com, data@example.com"})
+	as.NoError(err)
+	as.Equal([]string{"ops@example.com", "data@example.com"}, jn.notifiers[0].(emailNotifier).to)
+}
+
+func TestEmailNotifierGivesUpOnSilentServer(t *testing.T) {
+	as := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	as.NoError(err)
+	defer l.Close()
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			<-release
+			conn.Close()
+		}
+	}()
+
+	n := emailNotifier{address: l.Addr().String(), from: "factset-reader@example.com", to: []string{"ops@example.com"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	as.Error(n.Notify(ctx, jobEvent{Event: jobFailedEvent, JobID: "job1"}))
+	as.True(time.Since(start) < notifyTimeout)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// checkPointers reads the pointers of a destination and checks that the bundles they refer to exist,
+// are not empty and match their manifests, if there are any. It returns what was checked.
+func checkPointers(ctx context.Context, client S3Client, layout keyLayout) ([]string, error) {
+	checked := []string{}
+	for _, kind := range []string{daily, weekly} {
+		name := layout.pointerKey(kind)
+		data, err := client.GetData(ctx, name)
+		if err == errObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return checked, fmt.Errorf("Could not read pointer [%s]: %v", name, err)
+		}
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return checked, fmt.Errorf("Pointer [%s] is empty", name)
+		}
+		if err := checkPointedBundle(ctx, client, layout, key); err != nil {
+			return checked, fmt.Errorf("Pointer [%s]: %v", name, err)
+		}
+		checked = append(checked, fmt.Sprintf("%s -> %s", name, key))
+	}
+	return checked, nil
+}
+
+func checkPointedBundle(ctx context.Context, client S3Client, layout keyLayout, key string) error {
+	info, err := client.StatObject(ctx, key)
+	if err == errObjectNotFound {
+		return fmt.Errorf("[%s] does not exist", key)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not read [%s]: %v", key, err)
+	}
+	if info.size == 0 {
+		return fmt.Errorf("[%s] is empty", key)
+	}
+
+	parsed, ok := layout.parseDataKey(key)
+	if !ok {
+		return nil
+	}
+	manifestKey := layout.dataKey(parsed.kind, manifestName(parsed.file), parsed.jobID, parsed.date)
+	data, err := client.GetData(ctx, manifestKey)
+	if err == errObjectNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Could not read manifest [%s]: %v", manifestKey, err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("Could not parse manifest [%s]: %v", manifestKey, err)
+	}
+	if m.Bundle != parsed.file {
+		return fmt.Errorf("Manifest [%s] describes [%s] instead of [%s]", manifestKey, m.Bundle, parsed.file)
+	}
+	if jobID := info.metadata["job-id"]; jobID != "" && m.JobID != jobID {
+		return fmt.Errorf("Manifest [%s] is of job [%s], but [%s] was uploaded by job [%s]", manifestKey, m.JobID, key, jobID)
+	}
+	return nil
+}
+
+// checkPublishedPointers checks the pointers of every destination, those of the resources with their own layout included
+func (s service) checkPublishedPointers(ctx context.Context) (string, error) {
+	var checked []string
+	for _, d := range s.writeDestinations() {
+		client, err := NewStorageClient(d.config)
+		if err != nil {
+			return "", fmt.Errorf("Destination [%s]: %v", d.name, err)
+		}
+		var pointers []string
+		for _, rl := range resourceLayouts(s.files) {
+			layout, err := rl.keys(d.config)
+			if err != nil {
+				return "", fmt.Errorf("Destination [%s]: %v", d.name, err)
+			}
+			p, err := checkPointers(ctx, client, layout)
+			if err != nil {
+				return "", fmt.Errorf("Destination [%s]: %v", d.name, err)
+			}
+			pointers = append(pointers, p...)
+		}
+		checked = append(checked, fmt.Sprintf("%s: %v", d.name, pointers))
+	}
+	return strings.Join(checked, "; "), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPointers(t *testing.T) {
+	as := assert.New(t)
+
+	root, err := ioutil.TempDir("", "pointers")
+	as.NoError(err)
+	defer os.RemoveAll(root)
+	fs, err := NewFSClient(s3Config{bucket: root})
+	as.NoError(err)
+	layout, err := newKeyLayout("", "", "")
+	as.NoError(err)
+
+	checked, err := checkPointers(context.Background(), fs, layout)
+	as.NoError(err)
+	as.Empty(checked)
+
+	as.NoError(fs.PutData(context.Background(), "daily", []byte("2017-04-03/daily.zip"), objectOptions{}))
+	_, err = checkPointers(context.Background(), fs, layout)
+	as.Error(err)
+
+	as.NoError(fs.PutData(context.Background(), "2017-04-03/daily.zip", []byte("zip"), objectOptions{}))
+	checked, err = checkPointers(context.Background(), fs, layout)
+	as.NoError(err)
+	as.Equal([]string{"daily -> 2017-04-03/daily.zip"}, checked)
+
+	as.NoError(fs.PutData(context.Background(), "2017-04-03/daily.manifest.json", []byte(`{"jobId":"job1","bundle":"daily.zip"}`), objectOptions{}))
+	_, err = checkPointers(context.Background(), fs, layout)
+	as.NoError(err)
+
+	as.NoError(fs.PutData(context.Background(), "2017-04-03/daily.manifest.json", []byte(`{"jobId":"job1","bundle":"weekly.zip"}`), objectOptions{}))
+	_, err = checkPointers(context.Background(), fs, layout)
+	as.Error(err)
+
+	as.NoError(fs.PutData(context.Background(), "2017-04-03/daily.manifest.json", []byte(`{"jobId":"job1","bundle":"daily.zip"}`), objectOptions{}))
+	as.NoError(fs.PutData(context.Background(), "2017-04-03/daily.zip", []byte{}, objectOptions{}))
+	_, err = checkPointers(context.Background(), fs, layout)
+	as.Error(err)
+}
+
+func TestCheckPointedBundleComparesJobIDs(t *testing.T) {
+	as := assert.New(t)
+
+	layout, err := newKeyLayout("", "", "")
+	as.NoError(err)
+	client := &httpS3ClientMock{
+		statObjectMock: func(objectName string) (objectInfo, error) {
+			return objectInfo{key: objectName, size: 3, metadata: map[string]string{"job-id": "job2"}}, nil
+		},
+		getDataMock: func(objectName string) ([]byte, error) {
+			return []byte(`{"jobId":"job1","bundle":"weekly.zip"}`), nil
+		},
+	}
+	err = checkPointedBundle(context.Background(), client, layout, "2017-04-01/weekly.zip")
+	as.Error(err)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+)
+
+// progressHook is the minio progress reader: minio "reads" every uploaded chunk from it
+type progressHook struct {
+	uploaded int64
+	report   func(uploaded int64)
+}
+
+func (p *progressHook) Read(b []byte) (int, error) {
+	p.report(atomic.AddInt64(&p.uploaded, int64(len(b))))
+	return len(b), nil
+}
+
+// progressReader reports how much of the wrapped reader has been read
+type progressReader struct {
+	r    io.Reader
+	hook *progressHook
+}
+
+// withProgress wraps the reader to report the upload progress, if there is anything to report to
+func withProgress(r io.Reader, report func(uploaded int64)) io.Reader {
+	if report == nil {
+		return r
+	}
+	return &progressReader{r: r, hook: &progressHook{report: report}}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.hook.Read(b[:n])
+	}
+	return n, err
+}
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func withContext(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (c *contextReader) Read(b []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"archive/zip"
+	"context"
+	"fmt"
 	"io"
 	"os"
 	"path"
@@ -15,18 +17,36 @@ import (
 )
 
 type Reader interface {
-	Read(fRes factsetResource, dest string, isWeekly bool) ([]zipCollection, error)
+	Read(ctx context.Context, fRes factsetResource, dest string, isWeekly bool) ([]zipCollection, error)
+	Resolve(ctx context.Context, fRes factsetResource, isWeekly bool) ([]remoteArchive, error)
+	Inspect(ctx context.Context, fRes factsetResource, archive remoteArchive, dest string) ([]string, error)
+	Check(ctx context.Context, fRes factsetResource) error
 	Close()
 }
 
+// remoteArchive is a package on the Factset server selected for import
+type remoteArchive struct {
+	dir       string
+	name      string
+	size      int64
+	published time.Time
+}
+
 type FactsetReader struct {
 	client FactsetClient
+	log    *log.Entry
 }
 
-func NewReader(config sftpConfig) (Reader, error) {
+func NewReader(ctx context.Context, config sftpConfig, logger *log.Entry) (Reader, error) {
 	fc := &SFTPClient{config: config}
-	err := fc.Init()
-	return &FactsetReader{client: fc}, err
+	start := time.Now()
+	err := fc.Init(ctx)
+	sftpConnectDuration.Observe(time.Since(start).Seconds())
+	return &FactsetReader{client: fc, log: logger}, err
+}
+
+func (sfr *FactsetReader) logger() *log.Entry {
+	return orDefaultLog(sfr.log)
 }
 
 func (sfr *FactsetReader) Close() {
@@ -35,15 +55,46 @@ func (sfr *FactsetReader) Close() {
 	}
 }
 
-func (sfr *FactsetReader) Read(fRes factsetResource, dest string, isWeekly bool) ([]zipCollection, error) {
+func (sfr *FactsetReader) Read(ctx context.Context, fRes factsetResource, dest string, isWeekly bool) ([]zipCollection, error) {
 	var fileCollection []zipCollection
-	dir, res := path.Split(fRes.archive)
-	files, err := sfr.client.ReadDir(dir)
+	archives, err := sfr.Resolve(ctx, fRes, isWeekly)
 	if err != nil {
-		log.Warnf("Could not find %s on ftp server", dir)
 		return fileCollection, err
 	}
 
+	for _, archive := range archives {
+		filesToWrite := []string{}
+		start := time.Now()
+		err = sfr.download(ctx, archive.dir, archive.name, dest)
+		if err != nil {
+			return fileCollection, err
+		}
+		observeStep(downloadPhase, start)
+		downloadedBytes.WithLabelValues(fRes.archive).Add(float64(archive.size))
+
+		start = time.Now()
+		factsetFiles := strings.Split(fRes.fileNames, ";")
+		filesToWrite, err = sfr.unzip(archive.name, factsetFiles, dest)
+		if err != nil {
+			return fileCollection, err
+		}
+		observeStep(unzipStep, start)
+
+		fileCollection = append(fileCollection, zipCollection{archive: archive.name, filesToWrite: filesToWrite, published: archive.published})
+	}
+
+	return fileCollection, err
+}
+
+// Resolve returns the most recent packages of a resource, without downloading them
+func (sfr *FactsetReader) Resolve(ctx context.Context, fRes factsetResource, isWeekly bool) ([]remoteArchive, error) {
+	dir, res := path.Split(fRes.archive)
+	files, err := sfr.client.ReadDir(ctx, dir)
+	if err != nil {
+		sfr.logger().WithField(resourceField, fRes.archive).Warnf("Could not find %s on ftp server", dir)
+		return nil, err
+	}
+
 	if isWeekly == true {
 		var onlyWeeklyFiles []os.FileInfo
 		for _, file := range files {
@@ -56,38 +107,76 @@ func (sfr *FactsetReader) Read(fRes factsetResource, dest string, isWeekly bool)
 
 	mostRecentZipFiles, err := sfr.GetMostRecentZips(files, res)
 	if err != nil {
-		return fileCollection, err
+		return nil, err
 	}
 
-	for _, archive := range mostRecentZipFiles {
-		filesToWrite := []string{}
-		err = sfr.download(dir, archive, dest)
-		if err != nil {
-			return fileCollection, err
-		}
-		factsetFiles := strings.Split(fRes.fileNames, ";")
-		filesToWrite, err = sfr.unzip(archive, factsetFiles, dest)
-		if err != nil {
-			return fileCollection, err
+	infos := make(map[string]os.FileInfo)
+	for _, file := range files {
+		infos[file.Name()] = file
+	}
+
+	var archives []remoteArchive
+	for _, name := range mostRecentZipFiles {
+		archives = append(archives, remoteArchive{dir: dir, name: name, size: infos[name].Size(), published: infos[name].ModTime().UTC()})
+	}
+	return archives, nil
+}
+
+// Check returns an error if the directory of a resource cannot be listed or holds no package of the resource
+func (sfr *FactsetReader) Check(ctx context.Context, fRes factsetResource) error {
+	dir, res := path.Split(fRes.archive)
+	files, err := sfr.client.ReadDir(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("Could not list %s: %v", dir, err)
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), res) && strings.HasSuffix(file.Name(), ".zip") {
+			return nil
 		}
+	}
+	return fmt.Errorf("Found no package %s*.zip in %s", res, dir)
+}
 
-		fileCollection = append(fileCollection, zipCollection{archive: archive, filesToWrite: filesToWrite})
+// Inspect downloads a package and lists the files of the resource in it, without extracting them
+func (sfr *FactsetReader) Inspect(ctx context.Context, fRes factsetResource, archive remoteArchive, dest string) ([]string, error) {
+	err := sfr.download(ctx, archive.dir, archive.name, dest)
+	if err != nil {
+		return nil, err
 	}
+	r, err := zip.OpenReader(path.Join(dest, archive.name))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
 
-	return fileCollection, err
+	contents := []string{}
+	for _, f := range r.File {
+		for _, factsetFile := range strings.Split(fRes.fileNames, ";") {
+			if strings.Contains(f.Name, strings.TrimSuffix(factsetFile, ".txt")) {
+				contents = append(contents, f.Name)
+				break
+			}
+		}
+	}
+	return contents, nil
 }
 
-func (sfr *FactsetReader) download(filePath string, fileName string, dest string) error {
+func (sfr *FactsetReader) download(ctx context.Context, filePath string, fileName string, dest string) error {
 	start := time.Now()
 	fullName := path.Join(filePath, fileName)
-	log.Infof("Downloading file [%s]", fullName)
+	l := sfr.logger().WithField(archiveField, fullName)
+	l.Infof("Downloading file [%s]", fullName)
 
-	err := sfr.client.Download(fullName, dest)
+	err := sfr.client.Download(ctx, fullName, dest)
 	if err != nil {
 		return err
 	}
 
-	log.Infof("File [%s] was downloaded successfully in %s", fullName, time.Since(start).String())
+	l = l.WithField(durationField, time.Since(start).Seconds())
+	if fi, err := os.Stat(path.Join(dest, fileName)); err == nil {
+		l = l.WithField(bytesField, fi.Size())
+	}
+	l.Infof("File [%s] was downloaded successfully in %s", fullName, time.Since(start).String())
 	return nil
 }
 
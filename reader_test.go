@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"strings"
+	"time"
 )
 
 const isWeekly = false
@@ -244,7 +246,7 @@ func TestFactsetReader_GetLastVersionError(t *testing.T) {
 
 	sftpClient := sftpClientMock{
 		readDirMock: getReadDirMock([]string{"edm_premium_v1_full_9823372036854775808.zip", "edm_premium_v1_full_1522.zip"}),
-		downloadMock: func(fileName string, dest string) error {
+		downloadMock: func(ctx context.Context, fileName string, dest string) error {
 			return nil
 		},
 	}
@@ -256,7 +258,7 @@ func TestFactsetReader_GetLastVersionError(t *testing.T) {
 		fileNames: "edm_security_entity_map.txt;edm_entities.txt",
 	}
 	dest := path.Join(dataFolder, dataFolder)
-	_, err := fsReader.Read(factsetRes, dest, isWeekly)
+	_, err := fsReader.Read(context.Background(), factsetRes, dest, isWeekly)
 	as.Error(err)
 }
 
@@ -338,7 +340,7 @@ func TestFactsetReader_Download(t *testing.T) {
 		readDirMock: func(dir string) ([]os.FileInfo, error) {
 			return []os.FileInfo{}, nil
 		},
-		downloadMock: func(fileName string, dest string) error {
+		downloadMock: func(ctx context.Context, fileName string, dest string) error {
 			content, err := ioutil.ReadFile(fileName)
 			if err != nil {
 				return err
@@ -360,7 +362,7 @@ func TestFactsetReader_Download(t *testing.T) {
 		fileName: "edm_premium_v1_full_1532.zip",
 	}
 
-	err := fsReader.download(tc.path, tc.fileName, path.Join(dataFolder, dataFolder))
+	err := fsReader.download(context.Background(), tc.path, tc.fileName, path.Join(dataFolder, dataFolder))
 	as.NoError(err)
 
 	file, err := os.Open(path.Join(dataFolder, dataFolder, tc.fileName))
@@ -374,7 +376,7 @@ func TestFactsetReader_ReadRes(t *testing.T) {
 
 	sftpClient := sftpClientMock{
 		readDirMock: getReadDirMock([]string{"edm_premium_v1_full_1532.zip", "edm_premium_v1_1532.zip", "edm_premium_v1_full_1522.zip"}),
-		downloadMock: func(fileName string, dest string) error {
+		downloadMock: func(ctx context.Context, fileName string, dest string) error {
 			content, err := ioutil.ReadFile(fileName)
 			if err != nil {
 				return err
@@ -395,7 +397,7 @@ func TestFactsetReader_ReadRes(t *testing.T) {
 		fileNames: "edm_security_entity_map.txt",
 	}
 	dest := path.Join(dataFolder, "/weekly")
-	zipColls, err := fsReader.Read(factsetRes, dest, isWeekly)
+	zipColls, err := fsReader.Read(context.Background(), factsetRes, dest, isWeekly)
 	for _, zipColl := range zipColls {
 		as.NoError(err)
 		as.True(strings.Contains(zipColl.archive, "1532"))
@@ -418,7 +420,7 @@ func TestFactsetReader_Read_ReadDirErr(t *testing.T) {
 		readDirMock: func(dir string) ([]os.FileInfo, error) {
 			return nil, fmt.Errorf("Could not read directory [%s]", dir)
 		},
-		downloadMock: func(fileName string, dest string) error {
+		downloadMock: func(ctx context.Context, fileName string, dest string) error {
 			return nil
 		},
 	}
@@ -430,7 +432,7 @@ func TestFactsetReader_Read_ReadDirErr(t *testing.T) {
 		fileNames: "edm_security_entity_map.txt;edm_entities",
 	}
 	dest := path.Join(dataFolder, dataFolder)
-	_, err := fsReader.Read(factsetRes, dest, isWeekly)
+	_, err := fsReader.Read(context.Background(), factsetRes, dest, isWeekly)
 	as.Error(err)
 }
 
@@ -439,7 +441,7 @@ func TestFactsetReader_Read_DownloadError(t *testing.T) {
 
 	sftpClient := sftpClientMock{
 		readDirMock: getReadDirMock([]string{"edm_premium_v1_full_1532.zip", "edm_premium_v1_full_1522.zip"}),
-		downloadMock: func(fileName string, dest string) error {
+		downloadMock: func(ctx context.Context, fileName string, dest string) error {
 			return fmt.Errorf("Could not download file [%s] from [%s]", fileName, dest)
 		},
 	}
@@ -451,10 +453,40 @@ func TestFactsetReader_Read_DownloadError(t *testing.T) {
 		fileNames: "edm_security_entity_map.txt;edm_entities.txt",
 	}
 	dest := path.Join(dataFolder, dataFolder)
-	_, err := fsReader.Read(factsetRes, dest, isWeekly)
+	_, err := fsReader.Read(context.Background(), factsetRes, dest, isWeekly)
 	as.Error(err)
 }
 
+func TestFactsetReader_ReadRecordsPackageReleaseTime(t *testing.T) {
+	as := assert.New(t)
+
+	released := time.Date(2017, 4, 1, 18, 0, 0, 0, time.UTC)
+	sftpClient := sftpClientMock{
+		readDirMock: func(dir string) ([]os.FileInfo, error) {
+			return []os.FileInfo{
+				fileInfoMock{name: "edm_premium_v1_full_1532.zip", mtime: released},
+				fileInfoMock{name: "edm_premium_v1_full_1522.zip", mtime: released.AddDate(0, 0, -7)},
+			}, nil
+		},
+		downloadMock: func(ctx context.Context, fileName string, dest string) error {
+			return nil
+		},
+	}
+
+	fsReader := FactsetReader{client: &sftpClient}
+	factsetRes := factsetResource{
+		archive:   "data/edm_premium",
+		fileNames: "edm_security_entity_map.txt",
+	}
+	os.Mkdir(path.Join(dataFolder, weekly), 0755)
+	defer os.RemoveAll(path.Join(dataFolder, weekly))
+	zipColls, err := fsReader.Read(context.Background(), factsetRes, dataFolder, true)
+	as.NoError(err)
+	as.Len(zipColls, 1)
+	as.Equal("edm_premium_v1_full_1532.zip", zipColls[0].archive)
+	as.Equal(released, zipColls[0].published)
+}
+
 func getReadDirMock(files []string) func(dir string) ([]os.FileInfo, error) {
 	filesInfo := []fileInfoMock{}
 	for _, file := range files {
@@ -470,3 +502,53 @@ func getReadDirMock(files []string) func(dir string) ([]os.FileInfo, error) {
 	}
 
 }
+
+func TestFactsetReader_ResolveAndInspectDoNotExtract(t *testing.T) {
+	as := assert.New(t)
+
+	released := time.Date(2017, 4, 1, 18, 0, 0, 0, time.UTC)
+	sftpClient := sftpClientMock{
+		readDirMock: func(dir string) ([]os.FileInfo, error) {
+			return []os.FileInfo{
+				fileInfoMock{name: "edm_premium_v1_full_1532.zip", mtime: released},
+				fileInfoMock{name: "edm_premium_v1_full_1522.zip", mtime: released.AddDate(0, 0, -7)},
+			}, nil
+		},
+		downloadMock: func(ctx context.Context, fileName string, dest string) error {
+			return nil
+		},
+	}
+
+	fsReader := FactsetReader{client: &sftpClient}
+	factsetRes := factsetResource{
+		archive:   "data/edm_premium",
+		fileNames: "edm_security_entity_map.txt",
+	}
+	archives, err := fsReader.Resolve(context.Background(), factsetRes, true)
+	as.NoError(err)
+	as.Equal([]remoteArchive{{dir: "data/", name: "edm_premium_v1_full_1532.zip", published: released}}, archives)
+
+	contents, err := fsReader.Inspect(context.Background(), factsetRes, archives[0], dataFolder)
+	as.NoError(err)
+	as.Equal([]string{"edm_security_entity_map.txt"}, contents)
+	_, err = os.Stat(path.Join(dataFolder, weekly, "edm_security_entity_map.txt"))
+	as.True(os.IsNotExist(err))
+}
+
+func TestFactsetReader_CheckFindsPackagesOfResource(t *testing.T) {
+	as := assert.New(t)
+
+	sftpClient := sftpClientMock{
+		readDirMock: func(dir string) ([]os.FileInfo, error) {
+			if dir != "/datafeeds/edm/edm_premium/" {
+				return nil, os.ErrNotExist
+			}
+			return []os.FileInfo{fileInfoMock{name: "edm_premium_v1_full_1532.zip"}}, nil
+		},
+	}
+	fsReader := FactsetReader{client: &sftpClient}
+
+	as.NoError(fsReader.Check(context.Background(), factsetResource{archive: "/datafeeds/edm/edm_premium/edm_premium"}))
+	as.Error(fsReader.Check(context.Background(), factsetResource{archive: "/datafeeds/edm/edm_premium/edm_bbg_ids"}))
+	as.Error(fsReader.Check(context.Background(), factsetResource{archive: "/datafeeds/edm/edm_bbg_ids/edm_bbg_ids"}))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// remoteFile describes a file of a directory on the Factset server
+type remoteFile struct {
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	Modified     time.Time `json:"modified"`
+	Dir          bool      `json:"dir"`
+	MajorVersion *int      `json:"majorVersion,omitempty"`
+	MinorVersion *int      `json:"minorVersion,omitempty"`
+}
+
+// readRemoteDir lists a directory on the Factset server
+func (s service) readRemoteDir(ctx context.Context, dir string) ([]remoteFile, error) {
+	fc := &SFTPClient{config: s.rdConfig}
+	if err := fc.Init(ctx); err != nil {
+		return nil, err
+	}
+	defer fc.Close()
+
+	files, err := fc.ReadDir(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return describeRemoteFiles(files), nil
+}
+
+// describeRemoteFiles adds the package versions to the files whose names carry them
+func describeRemoteFiles(files []os.FileInfo) []remoteFile {
+	rd := FactsetReader{}
+	described := []remoteFile{}
+	for _, f := range files {
+		rf := remoteFile{Name: f.Name(), Size: f.Size(), Modified: f.ModTime().UTC(), Dir: f.IsDir()}
+		if !f.IsDir() {
+			if major, err := rd.getMajorVersion(f.Name()); err == nil {
+				if minor, err := rd.getMinorVersion(f.Name()); err == nil {
+					rf.MajorVersion = &major
+					rf.MinorVersion = &minor
+				}
+			}
+		}
+		described = append(described, rf)
+	}
+	return described
+}
+
+// getRemoteRoots parses a comma separated list of root paths; without one, the directories of the resources are the roots
+func getRemoteRoots(roots string, resources []factsetResource) []string {
+	var list []string
+	if roots != "" {
+		for _, root := range strings.Split(roots, resSeparator) {
+			if root = strings.TrimSpace(root); root != "" {
+				list = append(list, path.Clean("/"+root))
+			}
+		}
+		return list
+	}
+	for _, res := range resources {
+		list = append(list, path.Clean("/"+path.Dir(res.archive)))
+	}
+	return list
+}
+
+// allowedRemotePath cleans a path and checks that it is one of the roots or inside one of them
+func allowedRemotePath(p string, roots []string) (string, bool) {
+	if !strings.HasPrefix(p, "/") {
+		return "", false
+	}
+	p = path.Clean(p)
+	for _, root := range roots {
+		if p == root || strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/") {
+			return p, true
+		}
+	}
+	return "", false
+}
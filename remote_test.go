@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowedRemotePath(t *testing.T) {
+	as := assert.New(t)
+
+	roots := []string{"/datafeeds/edm"}
+	p, ok := allowedRemotePath("/datafeeds/edm", roots)
+	as.True(ok)
+	as.Equal("/datafeeds/edm", p)
+
+	p, ok = allowedRemotePath("/datafeeds/edm/edm_premium/", roots)
+	as.True(ok)
+	as.Equal("/datafeeds/edm/edm_premium", p)
+
+	_, ok = allowedRemotePath("/datafeeds/edm/../ppl", roots)
+	as.False(ok)
+	_, ok = allowedRemotePath("/datafeeds/edm_other", roots)
+	as.False(ok)
+	_, ok = allowedRemotePath("datafeeds/edm", roots)
+	as.False(ok)
+	_, ok = allowedRemotePath("", roots)
+	as.False(ok)
+}
+
+func TestGetRemoteRoots(t *testing.T) {
+	as := assert.New(t)
+
+	resources := getResourceList("/datafeeds/edm/edm_premium/edm_premium_full:edm_security_entity_map.txt")
+	as.Equal([]string{"/datafeeds/edm/edm_premium"}, getRemoteRoots("", resources))
+	as.Equal([]string{"/datafeeds", "/other"}, getRemoteRoots("/datafeeds/, other", resources))
+}
+
+func TestDescribeRemoteFiles(t *testing.T) {
+	as := assert.New(t)
+
+	modified := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	files := describeRemoteFiles([]os.FileInfo{
+		fileInfoMock{name: "edm_premium_full_v1_1234.zip", size: 10, mtime: modified},
+		fileInfoMock{name: "readme.txt", size: 5, mtime: modified},
+		fileInfoMock{name: "archive", mode: os.ModeDir, mtime: modified},
+	})
+	as.Len(files, 3)
+	as.Equal(1, *files[0].MajorVersion)
+	as.Equal(1234, *files[0].MinorVersion)
+	as.Equal(int64(10), files[0].Size)
+	as.Equal(modified, files[0].Modified)
+	as.Nil(files[1].MajorVersion)
+	as.True(files[2].Dir)
+}
+
+func TestGetRemoteRejectsPathsOutsideRoots(t *testing.T) {
+	as := assert.New(t)
+
+	s := service{remoteRoots: []string{"/datafeeds/edm"}}
+	rec := httptest.NewRecorder()
+	s.getRemote(rec, httptest.NewRequest("GET", "/remote?path=/etc", nil))
+	as.Equal(http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// retentionPolicy decides which published bundles are kept; a zero limit keeps everything of that kind
+type retentionPolicy struct {
+	dailyDays   int
+	weeklyCount int
+	dryRun      bool
+}
+
+func (p retentionPolicy) enabled() bool {
+	return p.dailyDays > 0 || p.weeklyCount > 0
+}
+
+// validate refuses a policy for keys without a fixed prefix, as it would list and clean up the whole bucket,
+// which may be shared with other teams
+func (p retentionPolicy) validate(layout keyLayout) error {
+	if p.enabled() && layout.listPrefix() == "" {
+		return errors.New("A retention policy needs a key template that starts with a fixed prefix, e.g. factset/{yyyy}-{mm}-{dd}/{file}")
+	}
+	return nil
+}
+
+// publication holds the objects (bundle and manifest) written for one kind of bundle by one import
+type publication struct {
+	kind       string
+	date       time.Time
+	jobID      string
+	keys       []string
+	referenced bool
+}
+
+// applyRetention deletes the publications not kept by the policy and returns their keys. Publications
+// referenced by a pointer are never deleted. With dryRun the keys are only returned.
+func applyRetention(ctx context.Context, client S3Client, layout keyLayout, policy retentionPolicy, now time.Time, dryRun bool) ([]string, error) {
+	if err := policy.validate(layout); err != nil {
+		return nil, err
+	}
+	pointers := map[string]bool{}
+	referenced := map[string]bool{}
+	for _, kind := range []string{daily, weekly} {
+		name := layout.pointerKey(kind)
+		pointers[name] = true
+		data, err := client.GetData(ctx, name)
+		if err == errObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read pointer [%s]: %v", name, err)
+		}
+		referenced[strings.TrimSpace(string(data))] = true
+	}
+
+	objects, err := client.ListObjects(ctx, layout.listPrefix())
+	if err != nil {
+		return nil, err
+	}
+	publications := map[string]*publication{}
+	for _, obj := range objects {
+		if pointers[obj.key] {
+			continue
+		}
+		info, ok := layout.parseDataKey(obj.key)
+		if !ok {
+			continue
+		}
+		date := info.date
+		if date.IsZero() {
+			date = obj.lastModified.UTC().Truncate(24 * time.Hour)
+		}
+		id := info.kind + "/" + date.Format("2006-01-02") + "/" + info.jobID
+		p, found := publications[id]
+		if !found {
+			p = &publication{kind: info.kind, date: date, jobID: info.jobID}
+			publications[id] = p
+		}
+		p.keys = append(p.keys, obj.key)
+		p.referenced = p.referenced || referenced[obj.key]
+	}
+
+	var expired []string
+	for _, p := range expiredPublications(publications, policy, now) {
+		expired = append(expired, p.keys...)
+	}
+	sort.Strings(expired)
+	if dryRun {
+		return expired, nil
+	}
+	for i, key := range expired {
+		if err := client.RemoveObject(ctx, key); err != nil {
+			return expired[:i], fmt.Errorf("Could not delete [%s]: %v", key, err)
+		}
+		log.Infof("Deleted expired object [%s]", key)
+	}
+	return expired, nil
+}
+
+func expiredPublications(publications map[string]*publication, policy retentionPolicy, now time.Time) []*publication {
+	var dailies, weeklies []*publication
+	for _, p := range publications {
+		if p.kind == weekly {
+			weeklies = append(weeklies, p)
+		} else {
+			dailies = append(dailies, p)
+		}
+	}
+
+	var expired []*publication
+	if policy.dailyDays > 0 {
+		cutoff := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -policy.dailyDays)
+		for _, p := range dailies {
+			if p.date.Before(cutoff) && !p.referenced {
+				expired = append(expired, p)
+			}
+		}
+	}
+	if policy.weeklyCount > 0 {
+		sort.Slice(weeklies, func(i, j int) bool {
+			if !weeklies[i].date.Equal(weeklies[j].date) {
+				return weeklies[i].date.After(weeklies[j].date)
+			}
+			return weeklies[i].jobID > weeklies[j].jobID
+		})
+		for i, p := range weeklies {
+			if i >= policy.weeklyCount && !p.referenced {
+				expired = append(expired, p)
+			}
+		}
+	}
+	return expired
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyRetention(t *testing.T) {
+	as := assert.New(t)
+
+	objects := map[string][]byte{
+		"daily":                                   []byte("factset/2017-03-01/daily.zip"),
+		"weekly":                                  []byte("factset/2017-03-27/weekly.zip"),
+		"factset/2017-03-01/daily.zip":            {},
+		"factset/2017-03-01/daily.manifest.json":  {},
+		"factset/2017-03-30/daily.zip":            {},
+		"factset/2017-03-30/daily.csv":            {},
+		"factset/2017-04-02/daily.zip":            {},
+		"factset/2017-04-02/daily.manifest.json":  {},
+		"factset/2017-03-13/weekly.zip":           {},
+		"factset/2017-03-20/weekly.zip":           {},
+		"factset/2017-03-20/weekly.manifest.json": {},
+		"factset/2017-03-27/weekly.zip":           {},
+		"factset/2017-04-03/weekly.zip":           {},
+		"other/2017-01-01/unrelated.txt":          {},
+	}
+	client := newInMemoryS3ClientMock(objects)
+	now := time.Date(2017, 4, 3, 12, 0, 0, 0, time.UTC)
+	policy := retentionPolicy{dailyDays: 3, weeklyCount: 1}
+	layout, err := newKeyLayout("factset/{yyyy}-{mm}-{dd}/{file}", "", "")
+	as.NoError(err)
+
+	expired, err := applyRetention(context.Background(), client, layout, policy, now, true)
+	as.NoError(err)
+	as.Equal([]string{"factset/2017-03-13/weekly.zip", "factset/2017-03-20/weekly.manifest.json", "factset/2017-03-20/weekly.zip", "factset/2017-03-30/daily.zip"}, expired)
+	as.Len(objects, 14)
+
+	expired, err = applyRetention(context.Background(), client, layout, policy, now, false)
+	as.NoError(err)
+	as.Len(expired, 4)
+	as.Len(objects, 10)
+	as.Contains(objects, "factset/2017-03-01/daily.zip")
+	as.Contains(objects, "factset/2017-03-27/weekly.zip")
+	as.Contains(objects, "factset/2017-03-30/daily.csv")
+	as.Contains(objects, "other/2017-01-01/unrelated.txt")
+}
+
+func TestApplyRetentionRefusesKeysWithoutPrefix(t *testing.T) {
+	as := assert.New(t)
+
+	objects := map[string][]byte{"2010-01-01/daily.zip": {}}
+	_, err := applyRetention(context.Background(), newInMemoryS3ClientMock(objects), keyLayout{}, retentionPolicy{dailyDays: 1}, time.Now(), false)
+	as.Error(err)
+	as.Len(objects, 1)
+}
+
+func TestApplyRetentionKeepsEverythingWithoutLimits(t *testing.T) {
+	as := assert.New(t)
+
+	objects := map[string][]byte{"2010-01-01/daily.zip": {}, "2010-01-01/weekly.zip": {}}
+	expired, err := applyRetention(context.Background(), newInMemoryS3ClientMock(objects), keyLayout{}, retentionPolicy{}, time.Now(), false)
+	as.NoError(err)
+	as.Empty(expired)
+	as.Len(objects, 2)
+}
@@ -2,35 +2,290 @@ package main
 
 import (
 	"bytes"
-	"github.com/minio/minio-go"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/encrypt"
+)
+
+const (
+	sseNone = "none"
+	sseS3   = "sse-s3"
+	sseKMS  = "sse-kms"
 )
 
+var errObjectNotFound = errors.New("The specified object does not exist")
+
+// S3Client is the object store the writer publishes to; besides S3 it is implemented for GCS, Azure Blob,
+// a local directory and an SFTP server (see NewStorageClient)
 type S3Client interface {
-	PutObject(objectName string, filePath string) (int64, error)
-	PutData(objectName string, data []byte) error
-	BucketExists(bucket string) (bool, error)
+	PutObject(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error)
+	PutData(ctx context.Context, objectName string, data []byte, opts objectOptions) error
+	GetData(ctx context.Context, objectName string) ([]byte, error)
+	StatObject(ctx context.Context, objectName string) (objectInfo, error)
+	RemoveObject(ctx context.Context, objectName string) error
+	ListObjects(ctx context.Context, prefix string) ([]objectInfo, error)
+	BucketExists(ctx context.Context, bucket string) (bool, error)
+}
+
+// objectOptions holds the settings of a single upload; encryption and tags apply to all uploads of a client
+type objectOptions struct {
+	contentType  string
+	storageClass string
+	metadata     map[string]string
+	progress     func(uploaded int64)
+}
+
+// objectInfo describes a stored object; metadata has lower case keys. What the backend knows about the content is
+// in md5 (the MD5 of the content), partSize (the part size of a multipart upload whose ETag is derived from the MD5s
+// of the parts) or verifiedOnUpload (S3 checked the Content-MD5 of every request of the upload, as its ETags are
+// no checksums, or the fs and sftp backends read the stored file back after writing it)
+type objectInfo struct {
+	key              string
+	size             int64
+	etag             string
+	md5              string
+	partSize         int64
+	verifiedOnUpload bool
+	metadata         map[string]string
+	lastModified     time.Time
 }
 
 type HTTPS3Client struct {
-	client *minio.Client
-	bucket string
+	client   *minio.Client
+	bucket   string
+	sse      encrypt.ServerSide
+	tags     map[string]string
+	partSize uint64
+	threads  uint
+}
+
+// minPartSize is the smallest part size S3 accepts for multipart uploads
+const minPartSize = 5 * 1024 * 1024
+
+// defaultPartSize is the part size minio uses unless a larger one is needed to stay within maxParts parts
+const defaultPartSize = 128 * 1024 * 1024
+
+const maxParts = 10000
+
+var multipartETagRegex = regexp.MustCompile("^[0-9a-f]{32}-[0-9]+$")
+
+// multipartPartSize returns the part size an upload of size bytes uses, chosen as minio does; objects smaller
+// than the part size are uploaded in a single part
+func multipartPartSize(size int64, configured int64) int64 {
+	if configured > 0 {
+		return configured
+	}
+	partSize := int64(math.Ceil(float64(size/maxParts)/defaultPartSize)) * defaultPartSize
+	if partSize < defaultPartSize {
+		return defaultPartSize
+	}
+	return partSize
 }
 
 func NewS3Client(config s3Config) (S3Client, error) {
-	mClient, err := minio.New(config.domain, config.accKey, config.secretKey, true)
-	return &HTTPS3Client{client: mClient, bucket: config.bucket}, err
+	if err := validateS3Config(config); err != nil {
+		return nil, err
+	}
+	sse, err := newServerSideEncryption(config.sse, config.kmsKeyID)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := newS3Credentials(config)
+	if err != nil {
+		return nil, err
+	}
+	mClient, err := minio.NewWithCredentials(config.domain, creds, true, config.region)
+	return &HTTPS3Client{
+		client:   mClient,
+		bucket:   config.bucket,
+		sse:      sse,
+		tags:     config.tags,
+		partSize: uint64(config.partSize),
+		threads:  uint(config.uploadThreads),
+	}, err
 }
 
-func (s3 *HTTPS3Client) PutObject(objectName string, filePath string) (int64, error) {
-	size, err := s3.client.FPutObject(s3.bucket, objectName, filePath, "application/octet-stream")
+// setS3MaxRetries sets how often minio retries every request, and so every part of a multipart upload.
+// The limit is a global of minio, so it is set once at startup, before any client exists, and applies to all destinations.
+func setS3MaxRetries(retries int) {
+	if retries > 0 {
+		minio.MaxRetry = retries
+	}
+}
+
+func validateS3Config(config s3Config) error {
+	if _, err := newServerSideEncryption(config.sse, config.kmsKeyID); err != nil {
+		return err
+	}
+	if _, err := newS3Credentials(config); err != nil {
+		return err
+	}
+	if config.partSize != 0 && config.partSize < minPartSize {
+		return fmt.Errorf("The multipart part size must be at least %d bytes", minPartSize)
+	}
+	if config.uploadThreads < 0 {
+		return errors.New("The number of upload threads must not be negative")
+	}
+	return nil
+}
+
+func newServerSideEncryption(sse string, kmsKeyID string) (encrypt.ServerSide, error) {
+	switch sse {
+	case "", sseNone:
+		return nil, nil
+	case sseS3:
+		return encrypt.NewSSE(), nil
+	case sseKMS:
+		if kmsKeyID == "" {
+			return nil, errors.New("A KMS key ID is required for SSE-KMS encryption")
+		}
+		return encrypt.NewSSEKMS(kmsKeyID, nil)
+	}
+	return nil, fmt.Errorf("Unknown server side encryption [%s], expected one of %s, %s, %s", sse, sseNone, sseS3, sseKMS)
+}
+
+func (s3 *HTTPS3Client) putOptions(opts objectOptions, defaultContentType string) minio.PutObjectOptions {
+	contentType := opts.contentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	putOptions := minio.PutObjectOptions{
+		ContentType:          contentType,
+		StorageClass:         opts.storageClass,
+		UserMetadata:         opts.metadata,
+		UserTags:             s3.tags,
+		ServerSideEncryption: s3.sse,
+		PartSize:             s3.partSize,
+		NumThreads:           s3.threads,
+		// minio uploads parts in parallel only without Content-MD5; uploads are verified by their ETags afterwards,
+		// except where the ETags are no checksums, so there every part is checked by S3 with its Content-MD5
+		SendContentMd5: s3.threads <= 1 || !s3.etagsAreChecksums(),
+	}
+	if opts.progress != nil {
+		putOptions.Progress = &progressHook{report: opts.progress}
+	}
+	return putOptions
+}
+
+func (s3 *HTTPS3Client) PutObject(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return 0, err
+	}
+	putOptions := s3.putOptions(opts, "application/octet-stream")
+	// the part size is set explicitly, so the ETag of the object can be computed from the local file
+	putOptions.PartSize = uint64(multipartPartSize(stat.Size(), int64(s3.partSize)))
+	size, err := s3.client.FPutObjectWithContext(ctx, s3.bucket, objectName, filePath, putOptions)
+	if err != nil {
+		// parts of a failed multipart upload are kept, and billed, until the upload is aborted
+		if rerr := s3.client.RemoveIncompleteUpload(s3.bucket, objectName); rerr != nil {
+			log.Warnf("Could not abort incomplete upload of [%s]: %v", objectName, rerr)
+		}
+	}
 	return size, err
 }
 
-func (s3 *HTTPS3Client) PutData(objectName string, data []byte) (err error) {
-	_, err = s3.client.PutObject(s3.bucket, objectName, bytes.NewReader(data), "text/plain")
+func (s3 *HTTPS3Client) PutData(ctx context.Context, objectName string, data []byte, opts objectOptions) (err error) {
+	_, err = s3.client.PutObjectWithContext(ctx, s3.bucket, objectName, bytes.NewReader(data), int64(len(data)), s3.putOptions(opts, "text/plain"))
 	return err
 }
 
-func (s3 *HTTPS3Client) BucketExists(bucket string) (bool, error) {
-	return s3.client.BucketExists(bucket)
+func (s3 *HTTPS3Client) GetData(ctx context.Context, objectName string) ([]byte, error) {
+	obj, err := s3.client.GetObjectWithContext(ctx, s3.bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3.translateError(err)
+	}
+	defer obj.Close()
+	data, err := ioutil.ReadAll(obj)
+	if err != nil {
+		return nil, s3.translateError(err)
+	}
+	return data, nil
+}
+
+func (s3 *HTTPS3Client) StatObject(ctx context.Context, objectName string) (objectInfo, error) {
+	info, err := s3.client.StatObjectWithContext(ctx, s3.bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return objectInfo{}, s3.translateError(err)
+	}
+	metadata := map[string]string{}
+	for k, v := range info.UserMetadata {
+		metadata[strings.ToLower(k)] = v
+	}
+	oi := objectInfo{key: info.Key, size: info.Size, etag: info.ETag, metadata: metadata, lastModified: info.LastModified}
+	switch {
+	case !s3.etagsAreChecksums():
+		oi.verifiedOnUpload = true
+	case s3.etagIsMD5(info.ETag):
+		oi.md5 = info.ETag
+	case multipartETagRegex.MatchString(info.ETag):
+		oi.partSize = multipartPartSize(info.Size, int64(s3.partSize))
+	}
+	return oi, nil
+}
+
+// etagsAreChecksums tells if the ETags are derived from the content, which is not the case with SSE-KMS
+func (s3 *HTTPS3Client) etagsAreChecksums() bool {
+	return s3.sse == nil || s3.sse.Type() == encrypt.S3
+}
+
+// etagIsMD5 tells if an ETag is the MD5 of the content, which is not the case for multipart uploads and SSE-KMS
+func (s3 *HTTPS3Client) etagIsMD5(etag string) bool {
+	if !s3.etagsAreChecksums() {
+		return false
+	}
+	if len(etag) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(etag)
+	return err == nil
+}
+
+// RemoveObject only checks ctx before the request, as minio cannot cancel a removal; the request itself is
+// bounded by the timeouts of the minio transport
+func (s3 *HTTPS3Client) RemoveObject(ctx context.Context, objectName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s3.client.RemoveObject(s3.bucket, objectName)
+}
+
+// ListObjects stops listing further pages once ctx is cancelled; minio cannot cancel the request of a page,
+// which is bounded by the timeouts of the minio transport
+func (s3 *HTTPS3Client) ListObjects(ctx context.Context, prefix string) ([]objectInfo, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	var objects []objectInfo
+	for obj := range s3.client.ListObjectsV2(s3.bucket, prefix, true, doneCh) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, objectInfo{key: obj.Key, size: obj.Size, etag: obj.ETag, lastModified: obj.LastModified})
+	}
+	return objects, nil
+}
+
+func (s3 *HTTPS3Client) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	return s3.client.BucketExistsWithContext(ctx, bucket)
+}
+
+func (s3 *HTTPS3Client) translateError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return errObjectNotFound
+	}
+	return err
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/minio/minio-go/v6/pkg/encrypt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServerSideEncryption(t *testing.T) {
+	as := assert.New(t)
+
+	sse, err := newServerSideEncryption("", "")
+	as.NoError(err)
+	as.Nil(sse)
+
+	sse, err = newServerSideEncryption(sseS3, "")
+	as.NoError(err)
+	as.Equal(encrypt.S3, sse.Type())
+
+	sse, err = newServerSideEncryption(sseKMS, "key-id")
+	as.NoError(err)
+	as.Equal(encrypt.KMS, sse.Type())
+
+	_, err = newServerSideEncryption(sseKMS, "")
+	as.Error(err)
+
+	_, err = newServerSideEncryption("sse-c", "")
+	as.Error(err)
+}
+
+func TestHTTPS3ClientPutOptions(t *testing.T) {
+	as := assert.New(t)
+
+	s3 := HTTPS3Client{sse: encrypt.NewSSE(), tags: map[string]string{"team": "content"}}
+	opts := s3.putOptions(objectOptions{storageClass: "STANDARD_IA", metadata: map[string]string{"job-id": "job1"}}, "text/plain")
+	as.Equal("text/plain", opts.ContentType)
+	as.Equal("STANDARD_IA", opts.StorageClass)
+	as.Equal(map[string]string{"job-id": "job1"}, opts.UserMetadata)
+	as.Equal(map[string]string{"team": "content"}, opts.UserTags)
+	as.NotNil(opts.ServerSideEncryption)
+
+	opts = s3.putOptions(objectOptions{contentType: "application/json"}, "text/plain")
+	as.Equal("application/json", opts.ContentType)
+}
+
+func TestHTTPS3ClientEtagIsMD5(t *testing.T) {
+	as := assert.New(t)
+
+	s3 := HTTPS3Client{}
+	as.True(s3.etagIsMD5("9e107d9d372bb6826bd81d3542a419d6"))
+	as.False(s3.etagIsMD5("9e107d9d372bb6826bd81d3542a419d6-3"))
+	as.False(s3.etagIsMD5(""))
+
+	kms, err := newServerSideEncryption(sseKMS, "key-id")
+	as.NoError(err)
+	s3 = HTTPS3Client{sse: kms}
+	as.False(s3.etagIsMD5("9e107d9d372bb6826bd81d3542a419d6"))
+}
+
+func TestHTTPS3ClientPutOptionsMultipart(t *testing.T) {
+	as := assert.New(t)
+
+	var reported int64
+	s3 := HTTPS3Client{partSize: 16 * 1024 * 1024, threads: 4}
+	opts := s3.putOptions(objectOptions{progress: func(uploaded int64) { reported = uploaded }}, "application/octet-stream")
+	as.Equal(uint64(16*1024*1024), opts.PartSize)
+	as.Equal(uint(4), opts.NumThreads)
+	as.False(opts.SendContentMd5)
+	opts.Progress.Read(make([]byte, 10))
+	opts.Progress.Read(make([]byte, 5))
+	as.Equal(int64(15), reported)
+
+	opts = (&HTTPS3Client{}).putOptions(objectOptions{}, "text/plain")
+	as.True(opts.SendContentMd5)
+	as.Nil(opts.Progress)
+
+	kms, err := newServerSideEncryption(sseKMS, "key-id")
+	as.NoError(err)
+	opts = (&HTTPS3Client{sse: kms, threads: 4}).putOptions(objectOptions{}, "application/octet-stream")
+	as.True(opts.SendContentMd5)
+}
+
+func TestMultipartPartSize(t *testing.T) {
+	as := assert.New(t)
+
+	as.Equal(int64(16*1024*1024), multipartPartSize(1024*1024*1024, 16*1024*1024))
+	as.Equal(int64(defaultPartSize), multipartPartSize(1024*1024*1024, 0))
+	as.Equal(int64(2*defaultPartSize), multipartPartSize(maxParts*(defaultPartSize+1), 0))
+}
+
+func TestNewS3ClientRejectsSmallParts(t *testing.T) {
+	as := assert.New(t)
+
+	_, err := NewS3Client(s3Config{domain: defaultS3Domain, partSize: 1024})
+	as.Error(err)
+}
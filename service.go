@@ -1,43 +1,262 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"path"
 
 	"archive/zip"
+	"encoding/json"
 	"errors"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
 	"io"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type service struct {
-	rdConfig sftpConfig
-	wrConfig s3Config
-	files    []factsetResource
-	weekly   bool
+	rdConfig           sftpConfig
+	wrConfig           s3Config
+	destinations       []destination
+	destinationsPolicy string
+	files              []factsetResource
+	weekly             bool
+	dryRun             bool
+	jobs               *jobRegistry
+	remoteRoots        []string
+	history            *importHistory
+	maxImportAge       map[string]time.Duration
+	phaseTimeouts      map[string]time.Duration
+	notifier           *jobNotifier
+}
+
+type triggeredJob struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
 }
 
 func (s service) forceImportWeekly(rw http.ResponseWriter, req *http.Request) {
 	s.weekly = true
-	go s.fetchResources()
-	log.Info("Triggered fetching last weekly files")
+	if s.dryRun || req.URL.Query().Get("dryRun") == "true" {
+		s.writeDryRun(rw, req)
+		return
+	}
+	job, err := s.startImport()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	jobLog(job.id).Info("Triggered fetching last weekly files")
+	writeTriggeredJob(rw, job)
 }
 
 func (s service) forceImport(rw http.ResponseWriter, req *http.Request) {
-	go s.fetchResources()
-	log.Info("Triggered fetching most recently released files")
+	if s.dryRun || req.URL.Query().Get("dryRun") == "true" {
+		s.writeDryRun(rw, req)
+		return
+	}
+	job, err := s.startImport()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	jobLog(job.id).Info("Triggered fetching most recently released files")
+	writeTriggeredJob(rw, job)
+}
+
+// startImport registers a new import job and runs it in the background, unless the service is shutting down
+func (s service) startImport() (importJob, error) {
+	job, err := newImportJob(s.weekly)
+	if err != nil {
+		return job, err
+	}
+	ctx, err := s.jobs.start(job)
+	if err != nil {
+		return job, err
+	}
+	go s.fetchResources(ctx, job)
+	return job, nil
+}
+
+// writeDryRun runs a dry run import while the request waits, and responds with its report
+func (s service) writeDryRun(rw http.ResponseWriter, req *http.Request) {
+	job, err := newImportJob(s.weekly)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jobLog(job.id).Infof("Starting dry run [%s]", job.id)
+	report, err := s.dryRunImport(req.Context(), job, req.URL.Query().Get("inspect") == "true")
+	if err != nil {
+		jobLog(job.id).Errorf("Dry run [%s] failed: %v", job.id, err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(report)
+}
+
+func writeTriggeredJob(rw http.ResponseWriter, job importJob) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(triggeredJob{ID: job.id, Status: "/jobs/" + job.id})
+}
+
+func (s service) listJobs(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(s.jobs.list())
+}
+
+func (s service) getJob(rw http.ResponseWriter, req *http.Request) {
+	js, found := s.jobs.get(mux.Vars(req)["id"])
+	if !found {
+		http.Error(rw, errJobNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(js)
+}
+
+// cancelJob aborts a running import job; it stops at the next phase, file or transfer it can interrupt
+func (s service) cancelJob(rw http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	switch err := s.jobs.cancel(id); err {
+	case nil:
+	case errJobNotFound:
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	default:
+		http.Error(rw, err.Error(), http.StatusConflict)
+		return
+	}
+	jobLog(id).Infof("Cancelled import job [%s]", id)
+	js, _ := s.jobs.get(id)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(rw).Encode(js)
+}
+
+// getRemote lists a directory on the Factset server, if it is inside one of the configured root paths
+func (s service) getRemote(rw http.ResponseWriter, req *http.Request) {
+	dir, ok := allowedRemotePath(req.URL.Query().Get("path"), s.remoteRoots)
+	if !ok {
+		http.Error(rw, fmt.Sprintf("Path must be one of or inside %v", s.remoteRoots), http.StatusForbidden)
+		return
+	}
+	files, err := s.readRemoteDir(req.Context(), dir)
+	if err != nil {
+		log.WithField("path", dir).Warnf("Could not list %s on ftp server: %v", dir, err)
+		if os.IsNotExist(err) {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(files)
+}
+
+type retentionResult struct {
+	Destination string   `json:"destination"`
+	DryRun      bool     `json:"dryRun"`
+	Deleted     []string `json:"deleted"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// enforceRetention applies the retention policy of every destination; with dryRun=true it only lists what would be deleted
+func (s service) enforceRetention(rw http.ResponseWriter, req *http.Request) {
+	dryRun := req.URL.Query().Get("dryRun") == "true"
+	status := http.StatusOK
+	results := []retentionResult{}
+	for _, d := range s.writeDestinations() {
+		deleted, err := s.applyRetention(req.Context(), d, dryRun)
+		result := retentionResult{Destination: d.name, DryRun: dryRun, Deleted: deleted}
+		if err != nil {
+			log.WithField(destinationField, d.name).Errorf("Could not enforce retention policy of destination [%s]: %v", d.name, err)
+			result.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+		results = append(results, result)
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(results)
+}
+
+func (s service) applyRetention(ctx context.Context, d destination, dryRun bool) ([]string, error) {
+	if !d.config.retention.enabled() {
+		return []string{}, nil
+	}
+	client, err := NewStorageClient(d.config)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []string{}
+	for _, rl := range resourceLayouts(s.files) {
+		layout, err := rl.keys(d.config)
+		if err != nil {
+			return deleted, err
+		}
+		expired, err := applyRetention(ctx, client, layout, d.config.retention, time.Now(), dryRun)
+		deleted = append(deleted, expired...)
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// fetchResources runs an import job; once ctx is cancelled the job stops its downloads and uploads and is aborted
+func (s service) fetchResources(ctx context.Context, job importJob) error {
+	l := jobLog(job.id)
+	l.WithField("weekly", job.weekly).Infof("Starting import job [%s]", job.id)
+	err := s.importResources(ctx, job)
+	// notified before the job is finished, which cancels its context
+	s.notifier.jobFinished(ctx, job, s.files, err)
+	s.jobs.finish(job.id, err)
+	recordJob(job, err)
+	l = l.WithField(durationField, time.Since(job.started).Seconds())
+	if err != nil {
+		s.history.recordFailure(jobKind(job), err)
+		l.Errorf("Import job [%s] failed: %v", job.id, err)
+		return err
+	}
+	l.Infof("Import job [%s] finished successfully", job.id)
+	return nil
 }
 
-func (s service) fetchResources() error {
-	rd, err := NewReader(s.rdConfig)
+// importResources imports the resources of every layout in turn, each group of resources as its own bundles
+func (s service) importResources(ctx context.Context, job importJob) error {
+	l := jobLog(job.id)
+	s.jobs.setPhase(job.id, downloadPhase)
+	rd, err := NewReader(ctx, s.rdConfig, l.WithField(phaseField, downloadPhase))
 	if err != nil {
 		return err
 	}
 	defer rd.Close()
 
+	imported := false
+	for _, g := range groupResources(s.files) {
+		found, err := s.importGroup(ctx, job, rd, g)
+		if err != nil {
+			return err
+		}
+		imported = imported || found
+	}
+	if !imported {
+		return errors.New("Did not find any matching files")
+	}
+	return nil
+}
+
+// importGroup downloads, zips and uploads a group of resources; it returns false if none of them had files to import
+func (s service) importGroup(ctx context.Context, job importJob, rd Reader, g resourceGroup) (bool, error) {
+	l := jobLog(job.id)
+	s.jobs.setPhase(job.id, downloadPhase)
 	if _, err := os.Stat(dataFolder + "/" + weekly); os.IsNotExist(err) {
 		os.Mkdir(dataFolder+"/"+weekly, 0755)
 	}
@@ -47,36 +266,112 @@ func (s service) fetchResources() error {
 	}
 
 	var fileCollection []zipCollection
-	for _, res := range s.files {
-		requestedFiles, _ := rd.Read(res, dataFolder, s.weekly)
+	var readResources []string
+	downloadCtx, cancelDownload := s.phaseContext(ctx, downloadPhase)
+	defer cancelDownload()
+	for _, res := range g.files {
+		if err := s.interrupted(ctx, downloadCtx, downloadPhase); err != nil {
+			s.cleanUpWorkingDirectory(fileCollection, nil)
+			return false, err
+		}
+		requestedFiles, err := rd.Read(downloadCtx, res, dataFolder, s.weekly)
+		if err != nil {
+			l.WithFields(log.Fields{phaseField: downloadPhase, resourceField: res.archive}).Warnf("Could not read resource: %v", err)
+		}
+		if len(requestedFiles) > 0 {
+			readResources = append(readResources, res.archive)
+		}
 		for _, requestedFile := range requestedFiles {
 			fileCollection = append(fileCollection, requestedFile)
 		}
 	}
+	if err := s.interrupted(ctx, downloadCtx, downloadPhase); err != nil {
+		s.cleanUpWorkingDirectory(fileCollection, nil)
+		return false, err
+	}
+	if len(fileCollection) == 0 {
+		s.cleanUpWorkingDirectory(nil, nil)
+		return false, nil
+	}
 
+	job.published = publicationDate(fileCollection, job.started)
+	s.jobs.setPhase(job.id, zipPhase)
+	zipStart := time.Now()
 	filesToWrite, err := s.sortAndZipFiles(fileCollection)
+	observeStep(zipPhase, zipStart)
 
 	if err != nil {
-		return err
+		return false, err
 	}
-	if len(fileCollection) == 0 {
-		return errors.New("Did not find any matching files")
+	for _, f := range filesToWrite {
+		zl := l.WithFields(log.Fields{phaseField: zipPhase, objectField: f})
+		if fi, err := os.Stat(path.Join(dataFolder, f)); err == nil {
+			zl = zl.WithField(bytesField, fi.Size())
+		}
+		zl.Infof("Created zip [%s]", f)
 	}
 
-	wr, err := NewWriter(s.wrConfig)
+	progress := func(destination string, object string, uploaded int64, size int64) {
+		s.jobs.reportUpload(job.id, destination, object, uploaded, size)
+	}
+	wr, err := NewDestinationsWriter(g.layout.apply(s.writeDestinations()), s.destinationsPolicy, progress, l.WithField(phaseField, uploadPhase))
 	if err != nil {
-		return err
+		return false, err
 	}
 
+	var bundles []bundle
 	for _, fileToWrite := range filesToWrite {
-		err = wr.Write(dataFolder, fileToWrite)
+		m, err := newManifest(job, fileToWrite, fileCollection)
 		if err != nil {
-			return err
+			return false, err
+		}
+		bundles = append(bundles, bundle{fileName: fileToWrite, manifest: m})
+	}
+
+	if ctx.Err() != nil {
+		s.cleanUpWorkingDirectory(fileCollection, filesToWrite)
+		return false, errJobAborted
+	}
+	s.jobs.setPhase(job.id, uploadPhase)
+	uploadCtx, cancelUpload := s.phaseContext(ctx, uploadPhase)
+	defer cancelUpload()
+	err = wr.Write(uploadCtx, dataFolder, bundles)
+	s.jobs.reportDestinations(job.id, wr.Results())
+	if err != nil {
+		if ierr := s.interrupted(ctx, uploadCtx, uploadPhase); ierr != nil {
+			s.cleanUpWorkingDirectory(fileCollection, filesToWrite)
+			return false, ierr
 		}
+		return false, err
+	}
+	for _, res := range readResources {
+		lastSuccessfulImport.WithLabelValues(res).SetToCurrentTime()
+	}
+	for _, f := range filesToWrite {
+		s.history.recordPublished(fileKind(f), time.Now().UTC())
 	}
 
 	defer s.cleanUpWorkingDirectory(fileCollection, filesToWrite)
 
+	return true, nil
+}
+
+// phaseContext bounds a phase of a job by its timeout, if one is configured
+func (s service) phaseContext(ctx context.Context, phase string) (context.Context, context.CancelFunc) {
+	if timeout := s.phaseTimeouts[phase]; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// interrupted returns why a phase was stopped early: the job was aborted or the phase timed out
+func (s service) interrupted(ctx context.Context, phaseCtx context.Context, phase string) error {
+	if ctx.Err() != nil {
+		return errJobAborted
+	}
+	if phaseCtx.Err() != nil {
+		return fmt.Errorf("The %s phase did not finish within %s", phase, s.phaseTimeouts[phase])
+	}
 	return nil
 }
 
@@ -153,7 +448,6 @@ func zipFilesForUpload(fileTypes string) (string, error) {
 	if err != nil {
 		return zipFileName, err
 	}
-	log.Infof("Created zip of todays %s files", fileTypes)
 	return zipFileName, nil
 }
 
@@ -202,8 +496,6 @@ func (s service) sortAndZipFiles(colls []zipCollection) ([]string, error) {
 		filesToWrite = append(filesToWrite, weeklyFileName)
 		return filesToWrite, err
 	}
-
-	return []string{}, nil
 }
 
 func (s service) cleanUpWorkingDirectory(fileCollection []zipCollection, filesToWrite []string) {
@@ -229,22 +521,54 @@ func (s service) cleanUpWorkingDirectory(fileCollection []zipCollection, filesTo
 	os.Remove(path.Join(dataFolder + "/" + weekly))
 }
 
-func (s service) checkConnectivityToFactset() error {
-	reader, err := NewReader(s.rdConfig)
+// checkResourcesAvailable checks that the packages of every resource can be found on the Factset server,
+// so that feeds removed from the entitlements show up before the next import
+func (s service) checkResourcesAvailable(ctx context.Context) (string, error) {
+	rd, err := NewReader(ctx, s.rdConfig, nil)
+	if rd != nil {
+		defer rd.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for _, res := range s.files {
+		if err := rd.Check(ctx, res); err != nil {
+			missing = append(missing, fmt.Sprintf("Resource [%s]: %v", res.archive, err))
+		}
+	}
+	if len(missing) > 0 {
+		return "", errors.New(strings.Join(missing, "; "))
+	}
+	return fmt.Sprintf("Found the packages of %d resources", len(s.files)), nil
+}
+
+func (s service) checkConnectivityToFactset(ctx context.Context) error {
+	reader, err := NewReader(ctx, s.rdConfig, nil)
 	if reader != nil {
 		defer reader.Close()
 	}
 	return err
 }
 
-func (s service) checkConnectivityToAmazonS3() error {
-	s3, err := NewS3Client(s.wrConfig)
-	if err != nil {
-		return err
+// writeDestinations returns the configured destinations, or only the primary one if none are configured
+func (s service) writeDestinations() []destination {
+	if len(s.destinations) == 0 {
+		return []destination{{name: primaryDestinationName, config: s.wrConfig}}
 	}
-	_, err = s3.BucketExists(s.wrConfig.bucket)
-	if err != nil {
-		return err
+	return s.destinations
+}
+
+func (s service) checkConnectivityToAmazonS3(ctx context.Context) error {
+	for _, d := range s.writeDestinations() {
+		s3, err := NewStorageClient(d.config)
+		if err != nil {
+			return fmt.Errorf("Destination [%s]: %v", d.name, err)
+		}
+		_, err = s3.BucketExists(ctx, d.config.bucket)
+		if err != nil {
+			return fmt.Errorf("Destination [%s]: %v", d.name, err)
+		}
 	}
 	return nil
 }
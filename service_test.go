@@ -12,8 +12,8 @@ func TestSortAndZipFilesCreatesOneDailyAndOneWeeklyZipWhenValid(t *testing.T) {
 	as := assert.New(t)
 
 	ts := service{}
-	weeklyCollection := zipCollection{"weekly_files_full.zip", []string{"ppl_people.txt", "edm_entity.txt"}}
-	dailyCollection := zipCollection{"daily_files.zip", []string{"ppl_people_update.txt", "ppl_people_delete.txt", "edm_entity_update.txt", "edm_entity_delete.txt"}}
+	weeklyCollection := zipCollection{archive: "weekly_files_full.zip", filesToWrite: []string{"ppl_people.txt", "edm_entity.txt"}}
+	dailyCollection := zipCollection{archive: "daily_files.zip", filesToWrite: []string{"ppl_people_update.txt", "ppl_people_delete.txt", "edm_entity_update.txt", "edm_entity_delete.txt"}}
 	createTestDirectoriesAndFiles(weeklyCollection)
 	createTestDirectoriesAndFiles(dailyCollection)
 
@@ -30,7 +30,7 @@ func TestSortAndZipFilesCreatesOneWeeklyZipWhenValid(t *testing.T) {
 	as := assert.New(t)
 
 	ts := service{weekly: true}
-	weeklyCollection := zipCollection{"weekly_files_full.zip", []string{"ppl_people.txt", "edm_entity.txt"}}
+	weeklyCollection := zipCollection{archive: "weekly_files_full.zip", filesToWrite: []string{"ppl_people.txt", "edm_entity.txt"}}
 	createTestDirectoriesAndFiles(weeklyCollection)
 
 	zipColls := []zipCollection{weeklyCollection}
@@ -46,7 +46,7 @@ func TestSortAndZipFilesCreatesOneDailyZipWhenValid(t *testing.T) {
 	as := assert.New(t)
 
 	ts := service{}
-	dailyCollection := zipCollection{"daily_files.zip", []string{"ppl_people_update.txt", "ppl_people_delete.txt", "edm_entity_update.txt", "edm_entity_delete.txt"}}
+	dailyCollection := zipCollection{archive: "daily_files.zip", filesToWrite: []string{"ppl_people_update.txt", "ppl_people_delete.txt", "edm_entity_update.txt", "edm_entity_delete.txt"}}
 	createTestDirectoriesAndFiles(dailyCollection)
 
 	zipColls := []zipCollection{dailyCollection}
@@ -75,8 +75,8 @@ func TestCleanUpOfWorkingDirectory(t *testing.T) {
 	as := assert.New(t)
 
 	ts := service{}
-	weeklyCollection := zipCollection{"weekly_files_full.zip", []string{"ppl_people.txt", "edm_entity.txt"}}
-	dailyCollection := zipCollection{"daily_files.zip", []string{"ppl_people_update.txt", "ppl_people_delete.txt", "edm_entity_update.txt", "edm_entity_delete.txt"}}
+	weeklyCollection := zipCollection{archive: "weekly_files_full.zip", filesToWrite: []string{"ppl_people.txt", "edm_entity.txt"}}
+	dailyCollection := zipCollection{archive: "daily_files.zip", filesToWrite: []string{"ppl_people_update.txt", "ppl_people_delete.txt", "edm_entity_update.txt", "edm_entity_delete.txt"}}
 	createTestDirectoriesAndFiles(dailyCollection)
 	createTestDirectoriesAndFiles(weeklyCollection)
 
@@ -118,3 +118,14 @@ func removeCreatedDirectoriesAndFiles() {
 	os.Remove(path.Join(dataFolder, "weekly.zip"))
 	os.Remove(path.Join(dataFolder, "daily.zip"))
 }
+
+func TestDryRunBundlesFollowSortAndZipFiles(t *testing.T) {
+	as := assert.New(t)
+
+	dailyColl := zipCollection{archive: "edm_premium_v1_1532.zip"}
+	weeklyColl := zipCollection{archive: "edm_premium_v1_full_1532.zip"}
+	as.Equal([]string{daily}, dryRunBundles([]zipCollection{dailyColl}, false))
+	as.Equal([]string{daily, weekly}, dryRunBundles([]zipCollection{dailyColl, weeklyColl}, false))
+	as.Equal([]string{weekly}, dryRunBundles([]zipCollection{weeklyColl}, true))
+	as.Empty(dryRunBundles(nil, false))
+}
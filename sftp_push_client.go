@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/sftp"
+)
+
+// SFTPPushClient stores the objects as files under a root directory of an SFTP server.
+// It opens a new connection per operation, as uploads happen only a few times a day.
+// Storage classes, tags and metadata do not apply to files and are ignored.
+type SFTPPushClient struct {
+	config sftpConfig
+	root   string
+}
+
+func NewSFTPPushClient(config s3Config) (S3Client, error) {
+	if err := validateSFTPPushConfig(config); err != nil {
+		return nil, err
+	}
+	return &SFTPPushClient{config: config.sftpPush, root: config.bucket}, nil
+}
+
+func validateSFTPPushConfig(config s3Config) error {
+	if config.sftpPush.address == "" {
+		return errors.New("An address is required for the sftp storage backend")
+	}
+	if config.bucket == "" {
+		return errors.New("A root directory is required for the sftp storage backend")
+	}
+	return nil
+}
+
+// withClient runs f on a new connection; cancelling ctx closes the connection, as sftp requests cannot be interrupted
+func (sp *SFTPPushClient) withClient(ctx context.Context, f func(c *sftp.Client) error) error {
+	c := &SFTPClient{config: sp.config}
+	defer c.Close()
+	err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeOnCancel(ctx, c.Close)()
+	err = f(c.sftp)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (sp *SFTPPushClient) path(objectName string) (string, error) {
+	p := path.Join(sp.root, objectName)
+	if !strings.HasPrefix(p, strings.TrimSuffix(path.Clean(sp.root), "/")+"/") {
+		return "", errors.New("Object name [" + objectName + "] is outside of the root directory")
+	}
+	return p, nil
+}
+
+func (sp *SFTPPushClient) PutObject(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	var n int64
+	err = sp.withClient(ctx, func(c *sftp.Client) error {
+		n, err = sp.write(c, objectName, withContext(ctx, withProgress(src, opts.progress)))
+		return err
+	})
+	return n, err
+}
+
+func (sp *SFTPPushClient) PutData(ctx context.Context, objectName string, data []byte, opts objectOptions) error {
+	return sp.withClient(ctx, func(c *sftp.Client) error {
+		_, err := sp.write(c, objectName, withContext(ctx, strings.NewReader(string(data))))
+		return err
+	})
+}
+
+// write uploads to a temporary file first, so readers never see a partially written object,
+// and reads the stored file back to check it holds the bytes written
+func (sp *SFTPPushClient) write(c *sftp.Client, objectName string, r io.Reader) (int64, error) {
+	p, err := sp.path(objectName)
+	if err != nil {
+		return 0, err
+	}
+	err = mkdirAll(c, path.Dir(p))
+	if err != nil {
+		return 0, err
+	}
+	tmp := path.Join(path.Dir(p), "."+path.Base(p)+".tmp")
+	f, err := c.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	f.Close()
+	if err != nil {
+		c.Remove(tmp)
+		return n, err
+	}
+	err = replaceFile(c, tmp, p)
+	if err != nil {
+		c.Remove(tmp)
+		return n, err
+	}
+	stored, err := c.Open(p)
+	if err != nil {
+		return n, err
+	}
+	defer stored.Close()
+	return n, checkStored(objectName, stored, h.Sum(nil))
+}
+
+// sftpOpUnsupported is the SSH_FX_OP_UNSUPPORTED status of a server that does not know a request
+const sftpOpUnsupported = 8
+
+// replaceFile moves tmp to p in one step with the posix-rename@openssh.com extension, replacing p if it exists.
+// The plain SFTP rename fails if the target exists, so on servers without the extension p is removed first
+// and is missing until the rename is done.
+func replaceFile(c *sftp.Client, tmp string, p string) error {
+	err := c.PosixRename(tmp, p)
+	if se, ok := err.(*sftp.StatusError); !ok || se.Code != sftpOpUnsupported {
+		return err
+	}
+	log.Warnf("The sftp server does not support posix-rename, [%s] is removed before it is replaced and missing meanwhile", p)
+	if err := c.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return c.Rename(tmp, p)
+}
+
+func mkdirAll(c *sftp.Client, dir string) error {
+	if dir == "/" || dir == "." {
+		return nil
+	}
+	if info, err := c.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return errors.New("[" + dir + "] is not a directory")
+		}
+		return nil
+	}
+	err := mkdirAll(c, path.Dir(dir))
+	if err != nil {
+		return err
+	}
+	return c.Mkdir(dir)
+}
+
+func (sp *SFTPPushClient) GetData(ctx context.Context, objectName string) ([]byte, error) {
+	p, err := sp.path(objectName)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = sp.withClient(ctx, func(c *sftp.Client) error {
+		f, err := c.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data, err = ioutil.ReadAll(f)
+		return err
+	})
+	if os.IsNotExist(err) {
+		return nil, errObjectNotFound
+	}
+	return data, err
+}
+
+// StatObject reports files as verified on upload, as write has read every file back; the ETag is made of
+// the modification time and size, files carry no checksum
+func (sp *SFTPPushClient) StatObject(ctx context.Context, objectName string) (objectInfo, error) {
+	p, err := sp.path(objectName)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	var info objectInfo
+	err = sp.withClient(ctx, func(c *sftp.Client) error {
+		stat, err := c.Stat(p)
+		if err != nil {
+			return err
+		}
+		info = objectInfo{key: objectName, size: stat.Size(), etag: fileETag(stat), verifiedOnUpload: true, lastModified: stat.ModTime()}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return objectInfo{}, errObjectNotFound
+	}
+	return info, err
+}
+
+func (sp *SFTPPushClient) RemoveObject(ctx context.Context, objectName string) error {
+	p, err := sp.path(objectName)
+	if err != nil {
+		return err
+	}
+	err = sp.withClient(ctx, func(c *sftp.Client) error {
+		return c.Remove(p)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ListObjects lists the files under the root directory whose names start with the prefix, without their ETags
+func (sp *SFTPPushClient) ListObjects(ctx context.Context, prefix string) ([]objectInfo, error) {
+	var objects []objectInfo
+	var walk func(c *sftp.Client, dir string) error
+	walk = func(c *sftp.Client, dir string) error {
+		files, err := c.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			p := path.Join(dir, f.Name())
+			if f.IsDir() {
+				if err := walk(c, p); err != nil {
+					return err
+				}
+				continue
+			}
+			key := strings.TrimPrefix(p, strings.TrimSuffix(path.Clean(sp.root), "/")+"/")
+			if !strings.HasPrefix(f.Name(), ".") && strings.HasPrefix(key, prefix) {
+				objects = append(objects, objectInfo{key: key, size: f.Size(), lastModified: f.ModTime()})
+			}
+		}
+		return nil
+	}
+	err := sp.withClient(ctx, func(c *sftp.Client) error {
+		return walk(c, path.Clean(sp.root))
+	})
+	return objects, err
+}
+
+func (sp *SFTPPushClient) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	exists := false
+	err := sp.withClient(ctx, func(c *sftp.Client) error {
+		info, err := c.Stat(sp.root)
+		if err != nil {
+			return err
+		}
+		exists = info.IsDir()
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return exists, err
+}
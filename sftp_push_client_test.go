@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPipeSFTPClient returns a client of an in-process sftp server on the local file system
+func newPipeSFTPClient(t *testing.T) (*sftp.Client, func()) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverReader, serverWriter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	client, err := sftp.NewClientPipe(clientReader, clientWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, func() {
+		server.Close()
+		client.Close()
+	}
+}
+
+func TestReplaceFileReplacesExistingFile(t *testing.T) {
+	as := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "sftp-push")
+	as.NoError(err)
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, "daily")
+	tmp := path.Join(dir, ".daily.tmp")
+	as.NoError(ioutil.WriteFile(p, []byte("old/daily.zip"), 0644))
+	as.NoError(ioutil.WriteFile(tmp, []byte("new/daily.zip"), 0644))
+
+	c, closeClient := newPipeSFTPClient(t)
+	defer closeClient()
+	as.NoError(replaceFile(c, tmp, p))
+
+	data, err := ioutil.ReadFile(p)
+	as.NoError(err)
+	as.Equal("new/daily.zip", string(data))
+	_, err = os.Stat(tmp)
+	as.True(os.IsNotExist(err))
+}
+
+func TestSFTPPushClientWritesAndReadsBackFiles(t *testing.T) {
+	as := assert.New(t)
+
+	root, err := ioutil.TempDir("", "sftp-push")
+	as.NoError(err)
+	defer os.RemoveAll(root)
+	c, closeClient := newPipeSFTPClient(t)
+	defer closeClient()
+	sp := &SFTPPushClient{root: root}
+
+	n, err := sp.write(c, "2017-01-01/daily.zip", strings.NewReader("daily"))
+	as.NoError(err)
+	as.Equal(int64(5), n)
+	data, err := ioutil.ReadFile(path.Join(root, "2017-01-01", "daily.zip"))
+	as.NoError(err)
+	as.Equal("daily", string(data))
+	files, err := ioutil.ReadDir(path.Join(root, "2017-01-01"))
+	as.NoError(err)
+	as.Len(files, 1)
+}
@@ -0,0 +1,66 @@
+package main
+
+import "fmt"
+
+const (
+	s3Backend    = "s3"
+	gcsBackend   = "gcs"
+	azureBackend = "azure"
+	fsBackend    = "fs"
+	sftpBackend  = "sftp"
+)
+
+const defaultS3Domain = "s3.amazonaws.com"
+const gcsDomain = "storage.googleapis.com"
+
+// NewStorageClient returns the client of the storage backend selected in the config. All backends store
+// objects under the configured bucket, which is the container for Azure and the root directory for fs and sftp.
+// The backend is chosen per destination, not per resource: all resources of an import are published in the same bundles.
+func NewStorageClient(config s3Config) (S3Client, error) {
+	switch config.backend {
+	case "", s3Backend:
+		return NewS3Client(config)
+	case gcsBackend:
+		return NewS3Client(gcsConfig(config))
+	case azureBackend:
+		return NewAzureBlobClient(config)
+	case fsBackend:
+		return NewFSClient(config)
+	case sftpBackend:
+		return NewSFTPPushClient(config)
+	}
+	return nil, unknownBackendError(config.backend)
+}
+
+// validateStorageConfig checks the settings of the storage backend selected in the config, without creating a client
+func validateStorageConfig(config s3Config) error {
+	switch config.backend {
+	case "", s3Backend:
+		return validateS3Config(config)
+	case gcsBackend:
+		return validateS3Config(gcsConfig(config))
+	case azureBackend:
+		return validateAzureConfig(config)
+	case fsBackend:
+		return validateFSConfig(config)
+	case sftpBackend:
+		return validateSFTPPushConfig(config)
+	}
+	return unknownBackendError(config.backend)
+}
+
+// gcsConfig adapts the config to GCS, which is accessed through its S3 compatible XML API with HMAC keys;
+// it supports neither SSE headers nor tags
+func gcsConfig(config s3Config) s3Config {
+	if config.domain == "" || config.domain == defaultS3Domain {
+		config.domain = gcsDomain
+	}
+	config.sse = sseNone
+	config.tags = nil
+	return config
+}
+
+func unknownBackendError(backend string) error {
+	return fmt.Errorf("Unknown storage backend [%s], expected one of %s, %s, %s, %s, %s", backend,
+		s3Backend, gcsBackend, azureBackend, fsBackend, sftpBackend)
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"os"
 	"time"
 )
 
 type sftpClientMock struct {
 	readDirMock  func(dir string) ([]os.FileInfo, error)
-	downloadMock func(fileName string, dest string) error
+	downloadMock func(ctx context.Context, fileName string, dest string) error
 	initMock     func() error
 	closeMock    func()
 }
@@ -21,20 +22,28 @@ type fileInfoMock struct {
 }
 
 type httpS3ClientMock struct {
-	putObjectMock    func(objectName string, filePath string) (int64, error)
-	putData          func(objectName string, data []byte) error
+	putObjectMock    func(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error)
+	putData          func(objectName string, data []byte, opts objectOptions) error
+	getDataMock      func(objectName string) ([]byte, error)
+	statObjectMock   func(objectName string) (objectInfo, error)
+	removeObjectMock func(objectName string) error
+	listObjectsMock  func(prefix string) ([]objectInfo, error)
 	bucketExistsMock func(bucket string) (bool, error)
 }
 
-func (s *sftpClientMock) ReadDir(dir string) ([]os.FileInfo, error) {
+type writerMock struct {
+	writeMock func(ctx context.Context, src string, bundles []bundle) error
+}
+
+func (s *sftpClientMock) ReadDir(ctx context.Context, dir string) ([]os.FileInfo, error) {
 	return s.readDirMock(dir)
 }
 
-func (s *sftpClientMock) Download(fileName string, dest string) error {
-	return s.downloadMock(fileName, dest)
+func (s *sftpClientMock) Download(ctx context.Context, fileName string, dest string) error {
+	return s.downloadMock(ctx, fileName, dest)
 }
 
-func (s *sftpClientMock) Init() error {
+func (s *sftpClientMock) Init(ctx context.Context) error {
 	return s.initMock()
 }
 
@@ -66,14 +75,34 @@ func (fi fileInfoMock) Sys() interface{} {
 	return fi.sys
 }
 
-func (s3w *httpS3ClientMock) PutObject(objectName string, filePath string) (int64, error) {
-	return s3w.putObjectMock(objectName, filePath)
+func (s3w *httpS3ClientMock) PutObject(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
+	return s3w.putObjectMock(ctx, objectName, filePath, opts)
+}
+
+func (s3w *httpS3ClientMock) PutData(ctx context.Context, objectName string, data []byte, opts objectOptions) error {
+	return s3w.putData(objectName, data, opts)
+}
+
+func (s3w *httpS3ClientMock) GetData(ctx context.Context, objectName string) ([]byte, error) {
+	return s3w.getDataMock(objectName)
 }
 
-func (s3w *httpS3ClientMock) PutData(objectName string, data []byte) error {
-	return s3w.putData(objectName, data)
+func (s3w *httpS3ClientMock) StatObject(ctx context.Context, objectName string) (objectInfo, error) {
+	return s3w.statObjectMock(objectName)
 }
 
-func (s3w *httpS3ClientMock) BucketExists(bucket string) (bool, error) {
+func (s3w *httpS3ClientMock) RemoveObject(ctx context.Context, objectName string) error {
+	return s3w.removeObjectMock(objectName)
+}
+
+func (s3w *httpS3ClientMock) ListObjects(ctx context.Context, prefix string) ([]objectInfo, error) {
+	return s3w.listObjectsMock(prefix)
+}
+
+func (s3w *httpS3ClientMock) BucketExists(ctx context.Context, bucket string) (bool, error) {
 	return s3w.bucketExistsMock(bucket)
 }
+
+func (w *writerMock) Write(ctx context.Context, src string, bundles []bundle) error {
+	return w.writeMock(ctx, src, bundles)
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"path"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -9,33 +12,295 @@ import (
 )
 
 type Writer interface {
-	Write(src string, fileName string) error
+	Write(ctx context.Context, src string, bundles []bundle) error
 }
 
+type bundle struct {
+	fileName string
+	manifest manifest
+}
+
+const manifestObjects = "manifest"
+const pointerObjects = "pointer"
+
+// pointerTimeout bounds the update of the pointers, and separately their rollback
+const pointerTimeout = 2 * time.Minute
+
 type S3Writer struct {
-	s3Client S3Client
+	s3Client       S3Client
+	layout         keyLayout
+	storageClasses map[string]string
+	retention      retentionPolicy
+	attempts       int
+	progress       uploadProgressFunc
+	events         *eventEmitter
+	destination    string
+	backend        string
+	bucket         string
+	log            *log.Entry
 }
 
-func NewWriter(config s3Config) (Writer, error) {
-	s3, err := NewS3Client(config)
-	return &S3Writer{s3Client: s3}, err
+// uploadProgressFunc is told how many bytes of an object have been uploaded so far
+type uploadProgressFunc func(objectName string, uploaded int64, size int64)
+
+// pointerUpdate holds the new content of a pointer object and what it pointed to before the update
+type pointerUpdate struct {
+	name     string
+	key      string
+	jobID    string
+	previous []byte
+	existed  bool
 }
 
-func (s3w *S3Writer) Write(src string, fileName string) error {
-	log.Infof("Writing file [%s]", fileName)
-	s3ResFilePath := time.Now().Format("2006-01-02") + "/" + fileName
-	p := path.Join(src, fileName)
-	n, err := s3w.s3Client.PutObject(s3ResFilePath, p)
+func NewWriter(config s3Config, progress uploadProgressFunc, logger *log.Entry) (Writer, error) {
+	layout, err := newKeyLayout(config.keyTemplate, config.pointerTemplate, config.env)
 	if err != nil {
+		return nil, err
+	}
+	s3, err := NewStorageClient(config)
+	return &S3Writer{s3Client: s3, layout: layout, storageClasses: config.storageClasses, retention: config.retention, attempts: config.uploadAttempts, progress: progress,
+		events: config.events, destination: config.destination, backend: config.backend, bucket: config.bucket, log: logger}, err
+}
+
+func (s3w *S3Writer) logger() *log.Entry {
+	return orDefaultLog(s3w.log)
+}
+
+// Write publishes the bundles in two phases: all bundles and manifests are uploaded and verified first,
+// and only then are the pointer objects moved to them. If moving a pointer fails, the pointers already
+// moved are restored, so consumers never see a mix of old and new pointers. Once published, an event tells
+// consumers about the new bundles. Cancelling ctx stops the uploads, but not the pointer updates once they started.
+func (s3w *S3Writer) Write(ctx context.Context, src string, bundles []bundle) error {
+	date := bundlesPublicationDate(bundles)
+	var updates []pointerUpdate
+	for _, b := range bundles {
+		key, err := s3w.upload(ctx, src, date, b)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, pointerUpdate{name: s3w.layout.pointerKey(fileKind(b.fileName)), key: key, jobID: b.manifest.JobID})
+	}
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	log.Infof("Uploaded file [%s] of size [%d] successfully", s3ResFilePath, n)
-	ext := filepath.Ext(fileName)
-	name := fileName[0 : len(fileName)-len(ext)]
-	err = s3w.s3Client.PutData(name, []byte(s3ResFilePath))
+	err := s3w.publish(updates)
 	if err != nil {
 		return err
 	}
-	log.Infof("Uploaded file [%s] successfully", name)
+	s3w.events.emit(s3w.newPublishEvent(date, bundles, updates), s3w.logger())
+	s3w.cleanUp(ctx)
 	return nil
 }
+
+// cleanUp enforces the retention policy after a successful publish; failing to clean up does not fail the import
+func (s3w *S3Writer) cleanUp(ctx context.Context) {
+	if !s3w.retention.enabled() {
+		return
+	}
+	expired, err := applyRetention(ctx, s3w.s3Client, s3w.layout, s3w.retention, time.Now(), s3w.retention.dryRun)
+	if err != nil {
+		s3w.logger().Errorf("Could not enforce retention policy: %v", err)
+	}
+	if s3w.retention.dryRun {
+		s3w.logger().Infof("Retention policy would delete %v", expired)
+	}
+}
+
+func (s3w *S3Writer) upload(ctx context.Context, src string, date time.Time, b bundle) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	start := time.Now()
+	s3w.logger().WithField(objectField, b.fileName).Infof("Writing file [%s]", b.fileName)
+	kind := fileKind(b.fileName)
+	s3ResFilePath := s3w.layout.dataKey(kind, b.fileName, b.manifest.JobID, date)
+	p := path.Join(src, b.fileName)
+	d, err := fileDigest(p)
+	if err != nil {
+		return "", err
+	}
+	opts := objectOptions{storageClass: s3w.storageClasses[kind], metadata: withDigest(bundleMetadata(b.manifest), d)}
+	if s3w.progress != nil {
+		opts.progress = func(uploaded int64) {
+			s3w.progress(s3ResFilePath, uploaded, d.size)
+		}
+	}
+	err = s3w.putVerified(ctx, s3ResFilePath, d, func() error {
+		_, err := s3w.s3Client.PutObject(ctx, s3ResFilePath, p, opts)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	observeStep(uploadPhase, start)
+	s3w.logger().WithFields(log.Fields{objectField: s3ResFilePath, bytesField: d.size, durationField: time.Since(start).Seconds()}).
+		Infof("Uploaded file [%s] of size [%d] successfully", s3ResFilePath, d.size)
+
+	manifestData, err := b.manifest.marshal()
+	if err != nil {
+		return "", err
+	}
+	s3ManifestPath := s3w.layout.dataKey(kind, manifestName(b.fileName), b.manifest.JobID, date)
+	d = dataDigest(manifestData)
+	manifestOptions := objectOptions{contentType: "application/json", storageClass: s3w.storageClasses[manifestObjects], metadata: withDigest(bundleMetadata(b.manifest), d)}
+	err = s3w.putVerified(ctx, s3ManifestPath, d, func() error {
+		return s3w.s3Client.PutData(ctx, s3ManifestPath, manifestData, manifestOptions)
+	})
+	if err != nil {
+		return "", err
+	}
+	s3w.logger().WithFields(log.Fields{objectField: s3ManifestPath, bytesField: d.size}).Infof("Uploaded manifest [%s] successfully", s3ManifestPath)
+	return s3ResFilePath, nil
+}
+
+// putVerified uploads an object until its upload can be verified, the attempts are used up or ctx is cancelled
+func (s3w *S3Writer) putVerified(ctx context.Context, objectName string, d digest, put func() error) error {
+	attempts := s3w.attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = put()
+		if err == nil {
+			err = s3w.verify(ctx, objectName, d)
+		}
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s3w.logger().WithField(objectField, objectName).Warnf("Upload of [%s] failed (attempt %d of %d): %v", objectName, attempt, attempts, err)
+	}
+	return err
+}
+
+// verify compares the uploaded object with the local digest, by the checksum of the content the backend reports:
+// the MD5 of a single part upload or the ETag of a multipart upload computed from the local parts. An object without
+// any is only accepted if the backend checked the upload itself.
+// The SHA-256 in the object metadata is our own and proves nothing about the stored content.
+func (s3w *S3Writer) verify(ctx context.Context, objectName string, d digest) error {
+	info, err := s3w.s3Client.StatObject(ctx, objectName)
+	if err != nil {
+		return fmt.Errorf("Could not verify upload of [%s]: %v", objectName, err)
+	}
+	if info.size != d.size {
+		return fmt.Errorf("Uploaded object [%s] has size [%d], expected [%d]", objectName, info.size, d.size)
+	}
+	if info.etag == "" {
+		return fmt.Errorf("Uploaded object [%s] has no ETag", objectName)
+	}
+	switch {
+	case info.md5 != "":
+		if info.md5 != d.md5 {
+			return fmt.Errorf("Uploaded object [%s] has MD5 [%s], expected [%s]", objectName, info.md5, d.md5)
+		}
+	case info.partSize > 0:
+		etag, err := d.multipartETag(info.partSize)
+		if err != nil {
+			return fmt.Errorf("Could not verify upload of [%s]: %v", objectName, err)
+		}
+		if info.etag != etag {
+			return fmt.Errorf("Uploaded object [%s] has ETag [%s], expected [%s]", objectName, info.etag, etag)
+		}
+	case !info.verifiedOnUpload:
+		return fmt.Errorf("Upload of [%s] cannot be verified: the storage backend reports no checksum of its content", objectName)
+	}
+	return nil
+}
+
+// publish moves the pointers; once started, the update is not cancelled with the import, so the pointers are not
+// left half updated, but it is bounded by pointerTimeout
+func (s3w *S3Writer) publish(updates []pointerUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pointerTimeout)
+	defer cancel()
+	for i := range updates {
+		previous, err := s3w.s3Client.GetData(ctx, updates[i].name)
+		if err == errObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Could not read pointer [%s]: %v", updates[i].name, err)
+		}
+		updates[i].previous = previous
+		updates[i].existed = true
+	}
+
+	for i, u := range updates {
+		err := s3w.putVerified(ctx, u.name, dataDigest([]byte(u.key)), func() error {
+			return s3w.s3Client.PutData(ctx, u.name, []byte(u.key), s3w.pointerOptions(u.jobID))
+		})
+		if err != nil {
+			s3w.logger().WithField(objectField, u.name).Errorf("Could not update pointer [%s], rolling back: %v", u.name, err)
+			// the failed pointer is rolled back too: its update may have been stored even if it could not be verified
+			s3w.rollback(updates[:i+1])
+			return err
+		}
+		s3w.logger().WithField(objectField, u.name).Infof("Uploaded file [%s] successfully", u.name)
+	}
+	return nil
+}
+
+// rollback restores the pointers already moved, within a pointerTimeout of its own
+func (s3w *S3Writer) rollback(updates []pointerUpdate) {
+	ctx, cancel := context.WithTimeout(context.Background(), pointerTimeout)
+	defer cancel()
+	for _, u := range updates {
+		var err error
+		if u.existed {
+			err = s3w.putVerified(ctx, u.name, dataDigest(u.previous), func() error {
+				return s3w.s3Client.PutData(ctx, u.name, u.previous, s3w.pointerOptions(""))
+			})
+		} else {
+			err = s3w.s3Client.RemoveObject(ctx, u.name)
+		}
+		if err != nil {
+			s3w.logger().WithField(objectField, u.name).Errorf("Could not roll back pointer [%s]: %v", u.name, err)
+			continue
+		}
+		s3w.logger().WithField(objectField, u.name).Infof("Rolled back pointer [%s]", u.name)
+	}
+}
+
+func (s3w *S3Writer) pointerOptions(jobID string) objectOptions {
+	opts := objectOptions{storageClass: s3w.storageClasses[pointerObjects]}
+	if jobID != "" {
+		opts.metadata = map[string]string{"job-id": jobID}
+	}
+	return opts
+}
+
+// bundleMetadata describes the source of a bundle in the user metadata of the uploaded objects
+func bundleMetadata(m manifest) map[string]string {
+	metadata := map[string]string{}
+	if m.JobID != "" {
+		metadata["job-id"] = m.JobID
+	}
+	var packages, versions []string
+	for _, a := range m.Archives {
+		packages = append(packages, a.Name)
+		versions = append(versions, fmt.Sprintf("v%d_%d", a.MajorVersion, a.MinorVersion))
+	}
+	if len(packages) > 0 {
+		metadata["source-packages"] = strings.Join(packages, ",")
+		metadata["package-versions"] = strings.Join(versions, ",")
+	}
+	return metadata
+}
+
+// bundlesPublicationDate returns the single date all bundles of a run are published under
+func bundlesPublicationDate(bundles []bundle) time.Time {
+	for _, b := range bundles {
+		if !b.manifest.PublicationDate.IsZero() {
+			return b.manifest.PublicationDate.UTC()
+		}
+	}
+	return time.Now().UTC()
+}
+
+// fileKind returns the kind of a bundle (daily or weekly) from its file name
+func fileKind(fileName string) string {
+	ext := filepath.Ext(fileName)
+	return fileName[0 : len(fileName)-len(ext)]
+}
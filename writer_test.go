@@ -1,24 +1,27 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 )
 
-var s3TestFolderName = time.Now().Format("2006-01-02")
+var s3TestFolderName = time.Now().UTC().Format("2006-01-02")
 
 func TestS3Writer_Write(t *testing.T) {
 	as := assert.New(t)
 	var actualPutDataObjName string
 	var actualPutData string
+	uploadedSizes := map[string]int64{}
 
 	httpS3Client := httpS3ClientMock{
-		putObjectMock: func(objectName string, filePath string) (int64, error) {
+		putObjectMock: func(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
 			file, err := ioutil.ReadFile(filePath)
 			if err != nil {
 				return 0, err
@@ -42,21 +45,29 @@ func TestS3Writer_Write(t *testing.T) {
 				return 0, err
 			}
 			f.Close()
+			uploadedSizes[objectName] = int64(n)
 			return int64(n), nil
 		},
 		bucketExistsMock: func(bucket string) (bool, error) {
 			return true, nil
 		},
-		putData: func(objectName string, data []byte) error {
+		putData: func(objectName string, data []byte, opts objectOptions) error {
 			actualPutDataObjName = objectName
 			actualPutData = string(data[:])
+			uploadedSizes[objectName] = int64(len(data))
 			return nil
 		},
+		statObjectMock: func(objectName string) (objectInfo, error) {
+			return objectInfo{key: objectName, size: uploadedSizes[objectName], etag: "etag", verifiedOnUpload: true}, nil
+		},
+		getDataMock: func(objectName string) ([]byte, error) {
+			return nil, errObjectNotFound
+		},
 	}
 	wr := S3Writer{s3Client: &httpS3Client}
 	zipFile, _ := os.Create(path.Join(dataFolder, "daily.zip"))
 	zipFile.Close()
-	err := wr.Write(dataFolder, "daily.zip")
+	err := wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}})
 	as.NoError(err)
 
 	dbFile, err := os.Open(dataFolder + "/edm_security_entity_map_test.txt")
@@ -66,14 +77,14 @@ func TestS3Writer_Write(t *testing.T) {
 	err = os.RemoveAll(dataFolder + "/daily")
 	err = os.RemoveAll(dataFolder + "/daily.zip")
 	as.Equal("daily", actualPutDataObjName)
-	as.Equal(time.Now().Format("2006-01-02")+"/daily.zip", actualPutData)
+	as.Equal(s3TestFolderName+"/daily.zip", actualPutData)
 }
 
 func TestS3Writer_Write_Error(t *testing.T) {
 	as := assert.New(t)
 
 	httpS3Client := httpS3ClientMock{
-		putObjectMock: func(objectName string, filePath string) (int64, error) {
+		putObjectMock: func(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
 			return int64(0), errors.New("Could not connect to Amazaon S3")
 		},
 		bucketExistsMock: func(bucket string) (bool, error) {
@@ -81,8 +92,349 @@ func TestS3Writer_Write_Error(t *testing.T) {
 		},
 	}
 	wr := S3Writer{s3Client: &httpS3Client}
-	err := wr.Write(dataFolder, "daily.zip")
+	err := wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}})
 	as.NotNil(err)
 	as.Error(err)
 	err = os.RemoveAll(dataFolder + "/daily.zip")
 }
+
+// createTestBundles creates bundle files in the data folder, containing their own names
+func createTestBundles(fileNames ...string) func() {
+	for _, fileName := range fileNames {
+		ioutil.WriteFile(path.Join(dataFolder, fileName), []byte(fileName), 0644)
+	}
+	return func() {
+		for _, fileName := range fileNames {
+			os.Remove(path.Join(dataFolder, fileName))
+		}
+	}
+}
+
+func newInMemoryS3ClientMock(objects map[string][]byte) *httpS3ClientMock {
+	metadata := map[string]map[string]string{}
+	return &httpS3ClientMock{
+		putObjectMock: func(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
+			data, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				return 0, err
+			}
+			objects[objectName] = data
+			metadata[objectName] = opts.metadata
+			return int64(len(data)), nil
+		},
+		putData: func(objectName string, data []byte, opts objectOptions) error {
+			objects[objectName] = data
+			metadata[objectName] = opts.metadata
+			return nil
+		},
+		getDataMock: func(objectName string) ([]byte, error) {
+			data, found := objects[objectName]
+			if !found {
+				return nil, errObjectNotFound
+			}
+			return data, nil
+		},
+		statObjectMock: func(objectName string) (objectInfo, error) {
+			data, found := objects[objectName]
+			if !found {
+				return objectInfo{}, errObjectNotFound
+			}
+			d := dataDigest(data)
+			return objectInfo{key: objectName, size: d.size, etag: d.md5, md5: d.md5, metadata: metadata[objectName]}, nil
+		},
+		removeObjectMock: func(objectName string) error {
+			delete(objects, objectName)
+			return nil
+		},
+		listObjectsMock: func(prefix string) ([]objectInfo, error) {
+			var infos []objectInfo
+			for key, data := range objects {
+				if strings.HasPrefix(key, prefix) {
+					infos = append(infos, objectInfo{key: key, size: int64(len(data))})
+				}
+			}
+			return infos, nil
+		},
+	}
+}
+
+func TestS3Writer_Write_MovesPointersOnlyAfterAllUploadsAreVerified(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip", "weekly.zip")()
+
+	objects := map[string][]byte{"daily": []byte("old/daily.zip"), "weekly": []byte("old/weekly.zip")}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	httpS3Client.statObjectMock = func(objectName string) (objectInfo, error) {
+		if objectName == s3TestFolderName+"/weekly.zip" {
+			return objectInfo{}, errObjectNotFound
+		}
+		d := dataDigest(objects[objectName])
+		return objectInfo{key: objectName, size: d.size, etag: d.md5, md5: d.md5}, nil
+	}
+	wr := S3Writer{s3Client: httpS3Client}
+
+	err := wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}, {fileName: "weekly.zip"}})
+	as.Error(err)
+	as.Equal("old/daily.zip", string(objects["daily"]))
+	as.Equal("old/weekly.zip", string(objects["weekly"]))
+}
+
+func TestS3Writer_Write_StopsUploadsWhenCancelled(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip", "weekly.zip")()
+
+	objects := map[string][]byte{"daily": []byte("old/daily.zip"), "weekly": []byte("old/weekly.zip")}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	ctx, cancel := context.WithCancel(context.Background())
+	var uploaded []string
+	putObject := httpS3Client.putObjectMock
+	httpS3Client.putObjectMock = func(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
+		uploaded = append(uploaded, objectName)
+		cancel()
+		return putObject(ctx, objectName, filePath, opts)
+	}
+	wr := S3Writer{s3Client: httpS3Client, attempts: 3}
+
+	err := wr.Write(ctx, dataFolder, []bundle{{fileName: "daily.zip"}, {fileName: "weekly.zip"}})
+	as.Equal(context.Canceled, err)
+	as.Equal([]string{s3TestFolderName + "/daily.zip"}, uploaded)
+	as.Equal("old/daily.zip", string(objects["daily"]))
+	as.Equal("old/weekly.zip", string(objects["weekly"]))
+}
+
+func TestS3Writer_Write_RollsBackPointersWhenAnUpdateFails(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip", "weekly.zip")()
+
+	objects := map[string][]byte{"daily": []byte("old/daily.zip")}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	putData := httpS3Client.putData
+	httpS3Client.putData = func(objectName string, data []byte, opts objectOptions) error {
+		if objectName == "weekly" {
+			return errors.New("Could not connect to Amazon S3")
+		}
+		return putData(objectName, data, opts)
+	}
+	wr := S3Writer{s3Client: httpS3Client}
+
+	err := wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}, {fileName: "weekly.zip"}})
+	as.Error(err)
+	as.Equal("old/daily.zip", string(objects["daily"]))
+	_, found := objects["weekly"]
+	as.False(found)
+}
+
+func TestS3Writer_Write_RollsBackPointerThatFailsVerification(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip", "weekly.zip")()
+
+	objects := map[string][]byte{"daily": []byte("old/daily.zip"), "weekly": []byte("old/weekly.zip")}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	statObject := httpS3Client.statObjectMock
+	httpS3Client.statObjectMock = func(objectName string) (objectInfo, error) {
+		info, err := statObject(objectName)
+		if objectName == "weekly" && string(objects[objectName]) != "old/weekly.zip" {
+			info.md5 = "0000"
+		}
+		return info, err
+	}
+	wr := S3Writer{s3Client: httpS3Client}
+
+	err := wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}, {fileName: "weekly.zip"}})
+	as.Error(err)
+	as.Equal("old/daily.zip", string(objects["daily"]))
+	as.Equal("old/weekly.zip", string(objects["weekly"]))
+}
+
+func TestS3Writer_Write_RemovesNewPointersOnRollback(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip", "weekly.zip")()
+
+	objects := map[string][]byte{}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	putData := httpS3Client.putData
+	httpS3Client.putData = func(objectName string, data []byte, opts objectOptions) error {
+		if objectName == "weekly" {
+			return errors.New("Could not connect to Amazon S3")
+		}
+		return putData(objectName, data, opts)
+	}
+	wr := S3Writer{s3Client: httpS3Client}
+
+	err := wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}, {fileName: "weekly.zip"}})
+	as.Error(err)
+	_, found := objects["daily"]
+	as.False(found)
+	as.Contains(objects, s3TestFolderName+"/daily.zip")
+	as.Contains(objects, s3TestFolderName+"/daily.manifest.json")
+}
+
+func TestS3Writer_Write_UsesKeyLayout(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("weekly.zip")()
+
+	objects := map[string][]byte{}
+	layout, err := newKeyLayout("factset/{env}/{kind}/{jobId}/{file}", "factset/{env}/{kind}", "test")
+	as.NoError(err)
+	wr := S3Writer{s3Client: newInMemoryS3ClientMock(objects), layout: layout}
+
+	err = wr.Write(context.Background(), dataFolder, []bundle{{fileName: "weekly.zip", manifest: manifest{JobID: "job1"}}})
+	as.NoError(err)
+	as.Contains(objects, "factset/test/weekly/job1/weekly.zip")
+	as.Contains(objects, "factset/test/weekly/job1/weekly.manifest.json")
+	as.Equal("factset/test/weekly/job1/weekly.zip", string(objects["factset/test/weekly"]))
+}
+
+func TestS3Writer_Write_UsesOnePublicationDateForAllBundles(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip", "weekly.zip")()
+
+	objects := map[string][]byte{}
+	wr := S3Writer{s3Client: newInMemoryS3ClientMock(objects)}
+	published := time.Date(2017, 4, 1, 23, 30, 0, 0, time.UTC)
+
+	err := wr.Write(context.Background(), dataFolder, []bundle{
+		{fileName: "daily.zip", manifest: manifest{PublicationDate: published}},
+		{fileName: "weekly.zip", manifest: manifest{PublicationDate: published}},
+	})
+	as.NoError(err)
+	as.Equal("2017-04-01/daily.zip", string(objects["daily"]))
+	as.Equal("2017-04-01/weekly.zip", string(objects["weekly"]))
+}
+
+func TestS3Writer_Write_SetsStorageClassAndMetadata(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("weekly.zip")()
+
+	objects := map[string][]byte{}
+	options := map[string]objectOptions{}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	putObject := httpS3Client.putObjectMock
+	httpS3Client.putObjectMock = func(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
+		options[objectName] = opts
+		return putObject(ctx, objectName, filePath, opts)
+	}
+	putData := httpS3Client.putData
+	httpS3Client.putData = func(objectName string, data []byte, opts objectOptions) error {
+		options[objectName] = opts
+		return putData(objectName, data, opts)
+	}
+	storageClasses := map[string]string{weekly: "STANDARD_IA", manifestObjects: "STANDARD", pointerObjects: "REDUCED_REDUNDANCY"}
+	wr := S3Writer{s3Client: httpS3Client, storageClasses: storageClasses}
+	m := manifest{
+		JobID:           "job1",
+		PublicationDate: time.Date(2017, 4, 1, 0, 0, 0, 0, time.UTC),
+		Archives:        []manifestArchive{{Name: "edm_premium_v1_full_1532.zip", MajorVersion: 1, MinorVersion: 1532}},
+	}
+
+	err := wr.Write(context.Background(), dataFolder, []bundle{{fileName: "weekly.zip", manifest: m}})
+	as.NoError(err)
+
+	expectedMetadata := map[string]string{"job-id": "job1", "source-packages": "edm_premium_v1_full_1532.zip", "package-versions": "v1_1532"}
+	as.Equal(objectOptions{storageClass: "STANDARD_IA", metadata: withDigest(expectedMetadata, dataDigest([]byte("weekly.zip")))}, options["2017-04-01/weekly.zip"])
+	manifestDigest := dataDigest(objects["2017-04-01/weekly.manifest.json"])
+	as.Equal(objectOptions{contentType: "application/json", storageClass: "STANDARD", metadata: withDigest(expectedMetadata, manifestDigest)}, options["2017-04-01/weekly.manifest.json"])
+	as.Equal(objectOptions{storageClass: "REDUCED_REDUNDANCY", metadata: map[string]string{"job-id": "job1"}}, options["weekly"])
+}
+
+func TestS3Writer_Write_RetriesUploadsThatDoNotMatchTheLocalFile(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip")()
+
+	objects := map[string][]byte{}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	attempts := 0
+	putObject := httpS3Client.putObjectMock
+	httpS3Client.putObjectMock = func(ctx context.Context, objectName string, filePath string, opts objectOptions) (int64, error) {
+		attempts++
+		n, err := putObject(ctx, objectName, filePath, opts)
+		if attempts == 1 {
+			objects[objectName] = []byte("corrupt!!")
+		}
+		return n, err
+	}
+	wr := S3Writer{s3Client: httpS3Client, attempts: 2}
+
+	err := wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}})
+	as.NoError(err)
+	as.Equal(2, attempts)
+	as.Equal("daily.zip", string(objects[s3TestFolderName+"/daily.zip"]))
+}
+
+func TestS3Writer_Write_FailsWhenUploadsNeverMatch(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip")()
+
+	objects := map[string][]byte{}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	httpS3Client.statObjectMock = func(objectName string) (objectInfo, error) {
+		d := dataDigest(objects[objectName])
+		return objectInfo{key: objectName, size: d.size, etag: "etag-2", md5: "0000"}, nil
+	}
+	wr := S3Writer{s3Client: httpS3Client, attempts: 3}
+
+	err := wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}})
+	as.Error(err)
+	_, found := objects["daily"]
+	as.False(found)
+}
+
+func TestS3Writer_Write_VerifiesPointers(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip")()
+
+	objects := map[string][]byte{"daily": []byte("old/daily.zip")}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	putData := httpS3Client.putData
+	corrupt := 1
+	httpS3Client.putData = func(objectName string, data []byte, opts objectOptions) error {
+		err := putData(objectName, data, opts)
+		if objectName == "daily" && corrupt > 0 {
+			corrupt--
+			objects[objectName] = []byte("corrupt!!")
+		}
+		return err
+	}
+	wr := S3Writer{s3Client: httpS3Client, attempts: 2}
+
+	as.NoError(wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}}))
+	as.Equal(s3TestFolderName+"/daily.zip", string(objects["daily"]))
+
+	corrupt = 3
+	objects["daily"] = []byte("old/daily.zip")
+	as.Error(wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}}))
+}
+
+func TestS3Writer_Write_VerifiesMultipartETags(t *testing.T) {
+	as := assert.New(t)
+	defer createTestBundles("daily.zip")()
+
+	objects := map[string][]byte{}
+	httpS3Client := newInMemoryS3ClientMock(objects)
+	etag := "6db496f6e0e39bd26d2186c2a680d9ce-2"
+	httpS3Client.statObjectMock = func(objectName string) (objectInfo, error) {
+		d := dataDigest(objects[objectName])
+		if objectName == s3TestFolderName+"/daily.zip" {
+			return objectInfo{key: objectName, size: d.size, etag: etag, partSize: 5}, nil
+		}
+		return objectInfo{key: objectName, size: d.size, etag: d.md5, md5: d.md5}, nil
+	}
+	wr := S3Writer{s3Client: httpS3Client}
+
+	as.NoError(wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}}))
+
+	etag = "6db496f6e0e39bd26d2186c2a680d9ce-3"
+	as.Error(wr.Write(context.Background(), dataFolder, []bundle{{fileName: "daily.zip"}}))
+}
+
+func TestDigestMultipartETag(t *testing.T) {
+	as := assert.New(t)
+
+	d := dataDigest([]byte("daily.zip"))
+	etag, err := d.multipartETag(5)
+	as.NoError(err)
+	as.Equal("6db496f6e0e39bd26d2186c2a680d9ce-2", etag)
+	etag, err = d.multipartETag(9)
+	as.NoError(err)
+	as.Equal("9685e0330462f7e68b560f9ea24f254e-1", etag)
+}